@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/0men1/cochart/internal/handlers"
@@ -16,6 +19,7 @@ func WithCORS(h http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Origin, Upgrade, Connection, Sec-WebSocket-Key, Sec-WebSocket-Version")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Candle-Source, Retry-After")
 
 		if r.Method == "OPTIONS" {
 			return
@@ -27,34 +31,133 @@ func WithCORS(h http.Handler) http.Handler {
 
 func main() {
 	// UpdateEnvVars(".env")
+	env := os.Getenv("APP_ENV")
 
 	httpClient := http.Client{
 		Timeout: 10 * time.Second,
 	}
 
 	// Setup Providers
-	providers := map[string]market.ExchangeProvider{
-		"coinbase": &market.CoinbaseProvider{
-			Client:  &httpClient,
-			BaseURL: "https://api.exchange.coinbase.com",
-		},
+	var providers map[string]market.ExchangeProvider
+	switch os.Getenv("MARKET_DATA") {
+	case "simulated":
+		// Generated markets only, nothing leaves the machine
+		seed, _ := strconv.ParseUint(os.Getenv("SIM_SEED"), 10, 64)
+		sim := market.NewSimulatedProvider(seed)
+		if path := os.Getenv("SIM_MARKETS_FILE"); path != "" {
+			markets, err := market.LoadSimulatedMarkets(path)
+			if err != nil {
+				log.Fatalf("Loading SIM_MARKETS_FILE: %v", err)
+			}
+			sim.Markets = markets
+		}
+		providers = map[string]market.ExchangeProvider{
+			"simulated": sim,
+		}
+	default:
+		providers = map[string]market.ExchangeProvider{
+			"coinbase": &market.CoinbaseProvider{
+				Client:  &httpClient,
+				BaseURL: "https://api.exchange.coinbase.com",
+				WSURL:   "wss://ws-feed.exchange.coinbase.com",
+			},
+			"binance": &market.BinanceProvider{
+				Client:  &httpClient,
+				BaseURL: "https://api.binance.com",
+			},
+			"kraken": &market.KrakenProvider{
+				Client:  &httpClient,
+				BaseURL: "https://api.kraken.com",
+			},
+		}
+	}
+
+	if dir := os.Getenv("FILE_PROVIDER_DIR"); dir != "" {
+		loc, err := time.LoadLocation(os.Getenv("FILE_PROVIDER_TZ"))
+		if err != nil {
+			log.Fatalf("Loading FILE_PROVIDER_TZ: %v", err)
+		}
+		providers["file"] = &market.FileProvider{Dir: dir, Location: loc}
+	}
+
+	// Dev only: inject upstream faults into history fetches, live ticks are
+	// left alone. APP_ENV=development has to be set explicitly
+	historical := providers
+	if spec := os.Getenv("CHAOS"); spec != "" {
+		if env != "development" {
+			log.Fatalf("CHAOS is for development only, not APP_ENV=%s", env)
+		}
+		config, err := market.ParseChaosConfig(spec)
+		if err != nil {
+			log.Fatalf("Parsing CHAOS: %v", err)
+		}
+		log.Printf("Injecting upstream faults: %+v", config)
+		historical = market.WithChaos(providers, config)
 	}
 
 	// Setup Services
-	marketService := market.NewService(providers)
-	roomManager := rooms.NewManager()
+	marketService := market.NewService(historical)
+	if spec := os.Getenv("FAILOVER"); spec != "" {
+		groups, err := market.ParseFailoverGroups(spec)
+		if err != nil {
+			log.Fatalf("Parsing FAILOVER: %v", err)
+		}
+		marketService.Failover = groups
+	}
+	// Where symbols with no failover group are served from
+	venueOrder := os.Getenv("VENUE_ORDER")
+	if venueOrder == "" {
+		venueOrder = "coinbase,kraken,binance"
+	}
+	marketService.VenueOrder = strings.Split(venueOrder, ",")
+	if dir := os.Getenv("CANDLE_STORE_DIR"); dir != "" {
+		maxMB, err := strconv.ParseInt(os.Getenv("CANDLE_STORE_MAX_MB"), 10, 64)
+		if err != nil {
+			maxMB = 1024
+		}
+
+		store, err := market.OpenDiskStore(dir, maxMB<<20)
+		if err != nil {
+			log.Fatalf("Opening candle store: %v", err)
+		}
+		store.StartCompactor(context.Background(), time.Hour)
+		marketService.Store = store
+	}
+	streamer := market.NewStreamer(providers)
+	candleBuilder := market.NewCandleBuilder(marketService, streamer)
+	roomManager := rooms.NewManager(streamer, candleBuilder, marketService)
+	roomManager.Views = marketService.Popularity
 
 	// Setup Handlers
 	wsHandler := handlers.NewWSHandler(roomManager)
 	marketHandler := handlers.NewMarketHandler(marketService)
+	roomManager.Listed = marketHandler.SearchEngine
+	proxies, err := handlers.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Parsing TRUSTED_PROXIES: %v", err)
+	}
+	marketHandler.TrustedProxies = proxies
+	marketHandler.RefreshToken = os.Getenv("SEARCH_REFRESH_TOKEN")
+
+	refresh, err := time.ParseDuration(os.Getenv("SEARCH_REFRESH"))
+	if err != nil {
+		refresh = time.Hour
+	}
+	marketHandler.SearchEngine.StartRefresher(context.Background(), refresh)
 
 	// Routes
 	http.Handle("/rooms/create", WithCORS(http.HandlerFunc(wsHandler.CreateRoom)))
 	http.Handle("/rooms/join", WithCORS(http.HandlerFunc(wsHandler.JoinRoom)))
 	http.Handle("/candles", WithCORS(http.HandlerFunc(marketHandler.GetCandles)))
+	http.Handle("/candles/stream", WithCORS(http.HandlerFunc(marketHandler.StreamCandles)))
 	http.Handle("/search", WithCORS(http.HandlerFunc(marketHandler.Search)))
-
-	env := os.Getenv("APP_ENV")
+	http.Handle("GET /search/suggest", WithCORS(http.HandlerFunc(marketHandler.Suggest)))
+	http.Handle("GET /search/health", WithCORS(http.HandlerFunc(marketHandler.GetSearchHealth)))
+	// Operators only, so no CORS
+	http.Handle("POST /search/refresh", http.HandlerFunc(marketHandler.RefreshSearch))
+	http.Handle("/providers", WithCORS(http.HandlerFunc(marketHandler.GetProviders)))
+	http.Handle("/instruments", WithCORS(http.HandlerFunc(marketHandler.GetInstrument)))
+	http.Handle("GET /products/{exchange}/{id...}", WithCORS(http.HandlerFunc(marketHandler.GetProduct)))
 
 	if env == "production" {
 		certFile := "/etc/letsencrypt/live/api.cochart.app/fullchain.pem"
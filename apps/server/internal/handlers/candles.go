@@ -2,26 +2,114 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0men1/cochart/internal/market"
 )
 
-func getInterval(timeframe string) (int64, error) {
-	intervals := map[string]int64{
-		"1m":  60,
-		"5m":  300,
-		"15m": 900,
-		"1H":  3600,
-		"6H":  21600,
-		"1D":  86400,
+// writeFetchError maps typed provider errors onto the matching HTTP status.
+func writeFetchError(w http.ResponseWriter, err error) {
+	var perr *market.ProviderError
+
+	switch {
+	case errors.Is(err, market.ErrNotFound):
+		http.Error(w, "Symbol not found", http.StatusNotFound)
+	case errors.Is(err, market.ErrBadRequest):
+		http.Error(w, "Invalid candle request", http.StatusBadRequest)
+	case errors.Is(err, market.ErrRateLimited):
+		if errors.As(err, &perr) && perr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(perr.RetryAfter.Seconds()+0.5)))
+		}
+		http.Error(w, "Upstream rate limit reached", http.StatusServiceUnavailable)
+	case errors.Is(err, market.ErrCircuitOpen):
+		if errors.As(err, &perr) && perr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(perr.RetryAfter.Seconds()+0.5)))
+		}
+		http.Error(w, "Upstream unavailable", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "Failed to fetch candles", http.StatusInternalServerError)
+	}
+}
+
+// setSource tells the client which market actually served the candles.
+func setSource(w http.ResponseWriter, source market.Market) {
+	w.Header().Set("X-Candle-Source", source.String())
+}
+
+// viewer identifies who is asking, for counting views. The forwarded
+// address is only believed when the request came straight from a trusted
+// proxy, and then only the hop that proxy appended, since anything before it
+// was written by the client.
+func (h *MarketHandler) viewer(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	peer, err := netip.ParseAddr(host)
+	if err != nil || len(forwarded) == 0 || !h.trusted(peer.Unmap()) {
+		return host
+	}
+
+	hops := strings.Split(forwarded[len(forwarded)-1], ",")
+	if client := strings.TrimSpace(hops[len(hops)-1]); client != "" {
+		return client
 	}
+	return host
+}
 
-	if interval, ok := intervals[timeframe]; ok {
-		return interval, nil
+func (h *MarketHandler) trusted(addr netip.Addr) bool {
+	for _, p := range h.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
 	}
-	return 0, fmt.Errorf("unsupported interval")
+	return false
+}
+
+// ParseTrustedProxies reads a comma separated list of addresses and CIDR
+// ranges, such as "10.0.0.0/8,127.0.0.1".
+func ParseTrustedProxies(spec string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			p, err := netip.ParsePrefix(field)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", field, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", field, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// recordView counts a view of the market that served a request, as long as
+// it is one the search index lists. Failed or unknown requests are not
+// counted, so made up symbols cannot grow the view counts.
+func (h *MarketHandler) recordView(r *http.Request, source market.Market) {
+	if _, ok := h.SearchEngine.Product(source.Exchange, source.Symbol); !ok {
+		return
+	}
+	h.Service.Popularity.RecordView(source, h.viewer(r))
 }
 
 func parseTimeRange(r *http.Request) (int64, int64, error) {
@@ -34,6 +122,7 @@ func parseTimeRange(r *http.Request) (int64, int64, error) {
 		}
 	}
 
+	end = time.Now().Unix()
 	if endParam := r.URL.Query().Get("end"); endParam != "" {
 		if end, err = strconv.ParseInt(endParam, 10, 64); err != nil {
 			return 0, 0, fmt.Errorf("invalid end")
@@ -53,25 +142,142 @@ func (h *MarketHandler) GetCandles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	granularity, err := getInterval(timeframe)
+	tf, err := market.ParseTimeframe(timeframe)
 	if err != nil {
 		http.Error(w, "Unsupported timeframe", http.StatusBadRequest)
 		return
 	}
 
+	if r.URL.Query().Has("limit") {
+		h.getCandlesBefore(w, r, provider, symbol, tf)
+		return
+	}
+
 	start, end, err := parseTimeRange(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	candles, err := h.Service.FetchCandles(r.Context(), provider, symbol, start, end, granularity)
+	if r.URL.Query().Get("partial") == "true" {
+		result, err := h.Service.FetchTimeframePartialFrom(r.Context(), provider, symbol, start, end, tf)
+		if err != nil {
+			log.Printf("Fetch error: %v", err)
+			writeFetchError(w, err)
+			return
+		}
+
+		setSource(w, *result.Source)
+		h.recordView(r, *result.Source)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	candles, source, err := h.Service.FetchTimeframeFrom(r.Context(), provider, symbol, start, end, tf)
 	if err != nil {
 		log.Printf("Fetch error: %v", err)
-		http.Error(w, "Failed to fetch candles", http.StatusInternalServerError)
+		writeFetchError(w, err)
 		return
 	}
 
+	setSource(w, source)
+	h.recordView(r, source)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(candles)
 }
+
+func parseCursor(r *http.Request) (int64, int, error) {
+	before := time.Now().Unix()
+	if beforeParam := r.URL.Query().Get("before"); beforeParam != "" {
+		var err error
+		if before, err = strconv.ParseInt(beforeParam, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid before")
+		}
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 || limit > market.MaxPageLimit {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", market.MaxPageLimit)
+	}
+
+	return before, limit, nil
+}
+
+// getCandlesBefore serves the count based mode of GetCandles: the limit most
+// recent candles before a cursor, which defaults to now.
+func (h *MarketHandler) getCandlesBefore(w http.ResponseWriter, r *http.Request, provider, symbol string, tf market.Timeframe) {
+	before, limit, err := parseCursor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, source, err := h.Service.FetchCandlesBeforeFrom(r.Context(), provider, symbol, before, limit, tf)
+	if err != nil {
+		log.Printf("Fetch error: %v", err)
+		writeFetchError(w, err)
+		return
+	}
+
+	setSource(w, source)
+	h.recordView(r, source)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// StreamCandles writes candles as newline-delimited JSON chunks, in time
+// order, as soon as each block of the range is available. Blocks that fail
+// arrive as chunks carrying a fetch_failed gap.
+func (h *MarketHandler) StreamCandles(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	timeframe := r.URL.Query().Get("timeframe")
+	provider := r.URL.Query().Get("provider")
+
+	if symbol == "" || timeframe == "" {
+		http.Error(w, "Must include symbol/timeframe", http.StatusBadRequest)
+		return
+	}
+
+	tf, err := market.ParseTimeframe(timeframe)
+	if err != nil {
+		http.Error(w, "Unsupported timeframe", http.StatusBadRequest)
+		return
+	}
+
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	source := h.Service.Resolve(provider, symbol)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	setSource(w, source)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	wrote := false
+	err = h.Service.StreamCandles(r.Context(), source.Exchange, source.Symbol, start, end, tf, func(chunk market.CandleChunk) error {
+		wrote = true
+		if err := encoder.Encode(chunk); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	// Failed blocks are streamed as gaps, so the stream only fails before
+	// anything is written or once the client has stopped reading
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("Stream error: %v", err)
+		if !wrote {
+			writeFetchError(w, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0men1/cochart/internal/market"
+)
+
+func TestGetCandlesFailsOverToBackup(t *testing.T) {
+	sim := market.NewSimulatedProvider(42)
+	primary := market.NewChaosProvider(sim, market.ChaosConfig{ErrorRate: 1, RetryAfter: time.Millisecond})
+	service := market.NewService(map[string]market.ExchangeProvider{"primary": primary, "backup": sim})
+	service.Failover = []market.FailoverGroup{{Name: "SIM/BTC", Markets: []market.Market{
+		{Exchange: "primary", Symbol: "SIM-BTC"}, {Exchange: "backup", Symbol: "SIM-BTC"},
+	}}}
+	h := NewMarketHandler(service)
+
+	r := httptest.NewRequest(http.MethodGet, "/candles?provider=primary&symbol=SIM-BTC&timeframe=1m&start=1717200000&end=1717203000", nil)
+	w := httptest.NewRecorder()
+	h.GetCandles(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("X-Candle-Source"); got != "backup:SIM-BTC" {
+		t.Errorf("X-Candle-Source = %q, want backup:SIM-BTC", got)
+	}
+
+	var candles []market.Candlestick
+	if err := json.NewDecoder(w.Body).Decode(&candles); err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) == 0 {
+		t.Error("backup served no candles")
+	}
+}
+
+func TestStreamCandles(t *testing.T) {
+	service := market.NewService(map[string]market.ExchangeProvider{"simulated": market.NewSimulatedProvider(42)})
+	h := NewMarketHandler(service)
+
+	// 1000 minutes, four blocks
+	r := httptest.NewRequest(http.MethodGet, "/candles/stream?provider=simulated&symbol=SIM-BTC&timeframe=1m&start=1717200000&end=1717260000", nil)
+	w := httptest.NewRecorder()
+	h.StreamCandles(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("got status %d, %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	var chunks []market.CandleChunk
+	for decoder := json.NewDecoder(w.Body); decoder.More(); {
+		var chunk market.CandleChunk
+		if err := decoder.Decode(&chunk); err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if len(chunks) == 0 || !chunks[len(chunks)-1].Done {
+		t.Fatalf("got %d chunks, want the last one done", len(chunks))
+	}
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].Start != chunks[i-1].End+1 {
+			t.Errorf("chunk %d starts at %d, previous ended at %d", i, chunks[i].Start, chunks[i-1].End)
+		}
+	}
+
+	// Nothing was fetched, so nothing was streamed and the status says why
+	r = httptest.NewRequest(http.MethodGet, "/candles/stream?provider=simulated&symbol=SIM-NONE&timeframe=1m&start=1717200000&end=1717260000", nil)
+	w = httptest.NewRecorder()
+	h.StreamCandles(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown symbol: got status %d: %s", w.Code, w.Body)
+	}
+}
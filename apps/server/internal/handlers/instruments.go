@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GetInstrument looks an instrument up by canonical symbol, or by the id an
+// exchange uses for it when exchange and id are given.
+func (h *MarketHandler) GetInstrument(w http.ResponseWriter, r *http.Request) {
+	symbol := r.URL.Query().Get("symbol")
+	exchange := r.URL.Query().Get("exchange")
+	id := r.URL.Query().Get("id")
+
+	registry := h.Service.Instruments
+	if symbol == "" && exchange != "" && id != "" {
+		symbol, _ = registry.Canonical(exchange, id)
+	}
+	if symbol == "" {
+		http.Error(w, "Must include symbol, or exchange and id", http.StatusBadRequest)
+		return
+	}
+
+	instrument, ok := registry.Instrument(symbol)
+	if !ok {
+		http.Error(w, "Instrument not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(instrument)
+}
@@ -1,12 +1,24 @@
 package handlers
 
-import "github.com/0men1/cochart/internal/market"
+import (
+	"net/netip"
+
+	"github.com/0men1/cochart/internal/market"
+)
 
 type MarketHandler struct {
 	Service      *market.Service
 	SearchEngine *market.Engine
+	// TrustedProxies may set X-Forwarded-For, requests from anywhere else
+	// are identified by their own address
+	TrustedProxies []netip.Prefix
+	// RefreshToken guards on demand search index rebuilds, which are
+	// disabled while it is empty
+	RefreshToken string
 }
 
 func NewMarketHandler(service *market.Service) *MarketHandler {
-	return &MarketHandler{Service: service, SearchEngine: market.NewEngine(service.Providers)}
+	engine := market.NewEngine(service.Providers, service.Instruments)
+	engine.Popularity = service.Popularity
+	return &MarketHandler{Service: service, SearchEngine: engine}
 }
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// GetProduct returns the metadata of one product, at
+// /products/{exchange}/{id}. Ids may contain slashes, as in BTC/USDT.
+func (h *MarketHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	product, ok := h.SearchEngine.Product(r.PathValue("exchange"), r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
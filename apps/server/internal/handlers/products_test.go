@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0men1/cochart/internal/market"
+	"github.com/0men1/cochart/internal/market/cassette"
+)
+
+func TestGetProduct(t *testing.T) {
+	c, err := cassette.Open("../market/testdata/cassettes/products.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := market.NewService(map[string]market.ExchangeProvider{
+		"coinbase": &market.CoinbaseProvider{Client: c.Client(), BaseURL: "https://api.exchange.coinbase.com"},
+		"binance":  &market.BinanceProvider{Client: c.Client(), BaseURL: "https://api.binance.com"},
+	})
+	h := NewMarketHandler(service)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /products/{exchange}/{id...}", h.GetProduct)
+	get := func(path string) (*httptest.ResponseRecorder, market.Product) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var p market.Product
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, p
+	}
+
+	w, p := get("/products/coinbase/BTC-USD")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	if p.PriceIncrement != 0.01 || p.SizeIncrement != 0.00000001 || p.MinSize != 0.00001 || p.PricePrecision != 2 || p.SizePrecision != 8 {
+		t.Errorf("BTC-USD increments and precision = %+v", p)
+	}
+
+	// Ids with a slash, as the web client escapes them or not, and
+	// canonical symbols for venues that use another
+	for _, path := range []string{"/products/binance/BTC/USDT", "/products/binance/BTC%2FUSDT", "/products/coinbase/BTC/USD"} {
+		w, p := get(path)
+		if w.Code != http.StatusOK || p.Base != "BTC" {
+			t.Errorf("%s: got status %d, product %+v", path, w.Code, p)
+		}
+	}
+
+	for _, path := range []string{"/products/coinbase/NOPE-USD", "/products/nowhere/BTC-USD", "/products/coinbase/MKR-BTC"} {
+		if w, _ := get(path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want 404", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/0men1/cochart/internal/market"
+)
+
+type ProviderInfo struct {
+	ID           string              `json:"id"`
+	Capabilities market.Capabilities `json:"capabilities"`
+	Timeframes   []string            `json:"timeframes"`
+}
+
+func (h *MarketHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]ProviderInfo, 0, len(h.Service.Providers))
+	for id, provider := range h.Service.Providers {
+		providers = append(providers, ProviderInfo{
+			ID:           id,
+			Capabilities: provider.Capabilities(),
+			Timeframes:   h.Service.SupportedTimeframes(id),
+		})
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].ID < providers[j].ID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(providers)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/0men1/cochart/internal/market"
+)
+
+func TestGetProviders(t *testing.T) {
+	// Listings fail, only capabilities are wanted here
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	defer upstream.Close()
+
+	service := market.NewService(map[string]market.ExchangeProvider{
+		"coinbase":  &market.CoinbaseProvider{Client: upstream.Client(), BaseURL: upstream.URL},
+		"kraken":    &market.KrakenProvider{Client: upstream.Client(), BaseURL: upstream.URL},
+		"file":      &market.FileProvider{Dir: t.TempDir()},
+		"simulated": market.NewSimulatedProvider(42),
+	})
+	h := NewMarketHandler(service)
+
+	w := httptest.NewRecorder()
+	h.GetProviders(w, httptest.NewRequest(http.MethodGet, "/providers", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	var providers []struct {
+		ID           string         `json:"id"`
+		Capabilities map[string]any `json:"capabilities"`
+		Timeframes   []string       `json:"timeframes"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&providers); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	caps := make(map[string]map[string]any)
+	for _, p := range providers {
+		ids = append(ids, p.ID)
+		caps[p.ID] = p.Capabilities
+		if len(p.Timeframes) == 0 {
+			t.Errorf("%s lists no timeframes", p.ID)
+		}
+	}
+	if want := []string{"coinbase", "file", "kraken", "simulated"}; !slices.Equal(ids, want) {
+		t.Fatalf("got providers %v, want %v", ids, want)
+	}
+
+	// JSON numbers decode as float64
+	for _, tc := range []struct {
+		provider, key string
+		want          any
+	}{
+		{"coinbase", "historyStart", float64(1420070400)},
+		{"coinbase", "maxCandlesPerRequest", float64(300)},
+		{"coinbase", "maxHistoryCandles", nil},
+		{"coinbase", "volatile", nil},
+		{"kraken", "maxHistoryCandles", float64(720)},
+		{"kraken", "historyStart", nil},
+		{"file", "volatile", true},
+		{"file", "generated", nil},
+		{"simulated", "generated", true},
+		{"simulated", "volatile", nil},
+	} {
+		if got := caps[tc.provider][tc.key]; got != tc.want {
+			t.Errorf("%s %s = %v, want %v", tc.provider, tc.key, got, tc.want)
+		}
+	}
+}
@@ -1,27 +1,132 @@
 package handlers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0men1/cochart/internal/market"
 )
 
+const defaultSearchLimit = 20
+const maxSearchLimit = 100
+
+// Search answers /search with one page of results. q is optional when a
+// filter is given, so whole exchanges can be browsed. exchange, type,
+// quote and status take comma separated values. Pages are picked with
+// offset or with the cursor of the previous page.
 func (h *MarketHandler) Search(w http.ResponseWriter, r *http.Request) {
-	userInput := r.URL.Query().Get("q")
-	limit, err := strconv.Atoi(r.URL.Query().Get("l"))
+	params := r.URL.Query()
+	userInput := params.Get("q")
 
-	if err != nil {
-		http.Error(w, "Invalid limit", http.StatusBadRequest)
+	filter := market.SearchFilter{
+		Exchanges: listParam(params, "exchange"),
+		Types:     listParam(params, "type"),
+		Quotes:    listParam(params, "quote"),
+		Statuses:  listParam(params, "status"),
+	}
+	if strings.TrimSpace(userInput) == "" && filter.IsZero() {
+		http.Error(w, "Must include query or a filter", http.StatusBadRequest)
 		return
 	}
 
-	if userInput == "" {
-		http.Error(w, "Must include query", http.StatusBadRequest)
+	limit := defaultSearchLimit
+	if l := params.Get("l"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	offset := 0
+	if cursor := params.Get("cursor"); cursor != "" {
+		n, err := market.DecodeSearchCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	} else if o := params.Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	page := h.SearchEngine.Query(userInput, filter, offset, limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// listParam splits a comma separated query parameter, which may also be
+// repeated.
+func listParam(params url.Values, name string) []string {
+	var values []string
+	for _, v := range params[name] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+const defaultSuggestLimit = 10
+
+// Suggest answers /search/suggest with trending and most viewed markets,
+// for an empty search box.
+func (h *MarketHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	limit := defaultSuggestLimit
+	if l := r.URL.Query().Get("l"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.SearchEngine.Suggest(limit))
+}
+
+// refreshMinInterval keeps on demand rebuilds from hammering upstream.
+const refreshMinInterval = 10 * time.Second
+
+// GetSearchHealth reports how current the search index is.
+func (h *MarketHandler) GetSearchHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.SearchEngine.Health())
+}
+
+// RefreshSearch rebuilds the search index now and reports its health.
+// Provider failures show up in the health rather than failing the request.
+// It is for operators only: the request must carry RefreshToken as a
+// bearer token, and the endpoint is off while none is configured. An index
+// built within refreshMinInterval, including by a concurrent refresh, is
+// reported as it is.
+func (h *MarketHandler) RefreshSearch(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if h.RefreshToken == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.RefreshToken)) != 1 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	products := h.SearchEngine.Search(userInput, limit)
+	if _, err := h.SearchEngine.Refresh(refreshMinInterval); err != nil {
+		log.Printf("Search index refresh: %v", err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(products)
+	json.NewEncoder(w).Encode(h.SearchEngine.Health())
 }
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0men1/cochart/internal/market"
+)
+
+func TestRefreshSearchNeedsToken(t *testing.T) {
+	service := market.NewService(map[string]market.ExchangeProvider{"simulated": market.NewSimulatedProvider(42)})
+	h := NewMarketHandler(service)
+
+	refresh := func(authorization string) int {
+		r := httptest.NewRequest(http.MethodPost, "/search/refresh", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		h.RefreshSearch(w, r)
+		return w.Code
+	}
+
+	// Off until a token is configured
+	if code := refresh("Bearer "); code != http.StatusForbidden {
+		t.Errorf("no token configured: got %d, want 403", code)
+	}
+
+	h.RefreshToken = "secret"
+	for _, authorization := range []string{"", "secret", "Bearer wrong", "Bearer secre"} {
+		if code := refresh(authorization); code != http.StatusForbidden {
+			t.Errorf("Authorization %q: got %d, want 403", authorization, code)
+		}
+	}
+	if code := refresh("Bearer secret"); code != http.StatusOK {
+		t.Errorf("right token: got %d, want 200", code)
+	}
+}
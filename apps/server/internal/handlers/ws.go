@@ -12,16 +12,19 @@ import (
 )
 
 type WSHandler struct {
-	Manager  *rooms.RoomManager
-	Upgrader websocket.Upgrader
+	Manager     *rooms.RoomManager
+	Upgrader    websocket.Upgrader
+	WriteConfig rooms.WriteConfig
 }
 
 func NewWSHandler(manager *rooms.RoomManager) *WSHandler {
 	return &WSHandler{
 		Manager: manager,
 		Upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
+			CheckOrigin:       func(r *http.Request) bool { return true },
+			EnableCompression: true,
 		},
+		WriteConfig: rooms.DefaultWriteConfig,
 	}
 }
 
@@ -64,6 +67,7 @@ func (h *WSHandler) JoinRoom(w http.ResponseWriter, r *http.Request) {
 		Send:        make(chan []byte, 256),
 		DisplayName: displayName,
 		Room:        room,
+		Config:      h.WriteConfig,
 	}
 
 	room.Register <- client
@@ -0,0 +1,308 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const binanceKlineLimit = 1000
+
+// binanceIntervals maps the epoch aligned granularities to kline intervals.
+// Binance weeks and months are calendar aligned so they are left to the
+// resampler.
+var binanceIntervals = map[int64]string{
+	60:    "1m",
+	180:   "3m",
+	300:   "5m",
+	900:   "15m",
+	1800:  "30m",
+	3600:  "1h",
+	7200:  "2h",
+	14400: "4h",
+	21600: "6h",
+	28800: "8h",
+	43200: "12h",
+	86400: "1d",
+}
+
+// BinanceProvider serves Binance spot markets. Products use canonical
+// BASE/QUOTE ids which are mapped back to exchange symbols such as BTCUSDT.
+type BinanceProvider struct {
+	Client  *http.Client
+	BaseURL string
+
+	mu      sync.RWMutex
+	symbols map[string]string
+}
+
+func (b *BinanceProvider) ID() string {
+	return "binance"
+}
+
+func (b *BinanceProvider) Capabilities() Capabilities {
+	granularities := make([]int64, 0, len(binanceIntervals))
+	for g := range binanceIntervals {
+		granularities = append(granularities, g)
+	}
+	sort.Slice(granularities, func(i, j int) bool {
+		return granularities[i] < granularities[j]
+	})
+
+	return Capabilities{
+		Granularities:        granularities,
+		MaxCandlesPerRequest: binanceKlineLimit,
+		// Spot trading opened on July 14th 2017
+		HistoryStart: 1499990400,
+		AssetTypes:   []string{"crypto"},
+	}
+}
+
+// RateLimit keeps well inside the 6000 request weight per minute budget,
+// klines cost 2 each.
+func (b *BinanceProvider) RateLimit() RateLimit {
+	return RateLimit{Rate: 20, Burst: 40}
+}
+
+type binanceExchangeInfo struct {
+	Symbols []binanceSymbol `json:"symbols"`
+}
+
+type binanceSymbol struct {
+	Symbol                 string          `json:"symbol"`
+	Status                 string          `json:"status"`
+	BaseAsset              string          `json:"baseAsset"`
+	QuoteAsset             string          `json:"quoteAsset"`
+	IsSpotTradingAllowed   bool            `json:"isSpotTradingAllowed"`
+	IsMarginTradingAllowed bool            `json:"isMarginTradingAllowed"`
+	Filters                []binanceFilter `json:"filters"`
+}
+
+type binanceFilter struct {
+	FilterType string `json:"filterType"`
+	TickSize   string `json:"tickSize"`
+	StepSize   string `json:"stepSize"`
+	MinQty     string `json:"minQty"`
+}
+
+// binanceStatuses lists the symbol states worth offering. BREAK is what
+// delisted symbols are left in, so it is dropped with the rest.
+var binanceStatuses = map[string]string{
+	"TRADING": StatusOnline,
+	"HALT":    StatusHalted,
+}
+
+// binanceTicker is the part of a 24hr ticker the listing uses. QuoteVolume
+// is in the quote asset.
+type binanceTicker struct {
+	Symbol      string `json:"symbol"`
+	QuoteVolume string `json:"quoteVolume"`
+}
+
+func (b *BinanceProvider) GetProducts() ([]Product, error) {
+	var info binanceExchangeInfo
+	if err := b.get(context.Background(), "/api/v3/exchangeInfo", nil, &info); err != nil {
+		return nil, err
+	}
+
+	// Volume only ranks search results, a listing without it is still good
+	var tickers []binanceTicker
+	if err := b.get(context.Background(), "/api/v3/ticker/24hr", map[string]string{"type": "MINI"}, &tickers); err != nil {
+		log.Printf("Binance 24hr tickers: %v", err)
+	}
+	volumes := make(map[string]float64, len(tickers))
+	for _, t := range tickers {
+		volumes[t.Symbol], _ = strconv.ParseFloat(t.QuoteVolume, 64)
+	}
+
+	symbols := make(map[string]string, len(info.Symbols))
+	products := make([]Product, 0, len(info.Symbols))
+	for _, s := range info.Symbols {
+		status, ok := binanceStatuses[s.Status]
+		if !ok || !s.IsSpotTradingAllowed {
+			continue
+		}
+
+		id := s.BaseAsset + "/" + s.QuoteAsset
+		symbols[id] = s.Symbol
+		product := Product{
+			ID:       id,
+			Name:     s.Symbol,
+			Type:     "crypto",
+			Exchange: "binance",
+			Base:     s.BaseAsset,
+			Quote:    s.QuoteAsset,
+			Status:   status,
+			Spot:     true,
+			Margin:   s.IsMarginTradingAllowed,
+
+			Volume24h: volumes[s.Symbol],
+		}
+		for _, f := range s.Filters {
+			switch f.FilterType {
+			case "PRICE_FILTER":
+				product.PriceIncrement = parseIncrement(f.TickSize)
+				product.PricePrecision = decimalsOf(f.TickSize)
+			case "LOT_SIZE":
+				product.SizeIncrement = parseIncrement(f.StepSize)
+				product.SizePrecision = decimalsOf(f.StepSize)
+				product.MinSize = parseIncrement(f.MinQty)
+			}
+		}
+		products = append(products, product)
+	}
+
+	b.mu.Lock()
+	b.symbols = symbols
+	b.mu.Unlock()
+
+	return products, nil
+}
+
+// exchangeSymbol maps a canonical BASE/QUOTE id to the Binance symbol.
+// Ids that were never listed fall back to dropping the separator.
+func (b *BinanceProvider) exchangeSymbol(id string) string {
+	b.mu.RLock()
+	symbol, ok := b.symbols[id]
+	b.mu.RUnlock()
+	if ok {
+		return symbol
+	}
+	return strings.ReplaceAll(id, "/", "")
+}
+
+func (b *BinanceProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	interval, ok := binanceIntervals[granularity]
+	if !ok {
+		return nil, &ProviderError{Provider: "binance", Kind: ErrBadRequest, Message: fmt.Sprintf("no kline interval for %ds", granularity)}
+	}
+
+	params := map[string]string{
+		"symbol":   b.exchangeSymbol(symbol),
+		"interval": interval,
+		"endTime":  strconv.FormatInt(end*1000, 10),
+		"limit":    strconv.Itoa(binanceKlineLimit),
+	}
+
+	var candles []Candlestick
+	for from := start; from <= end; {
+		params["startTime"] = strconv.FormatInt(from*1000, 10)
+
+		var raw [][]json.RawMessage
+		if err := b.get(ctx, "/api/v3/klines", params, &raw); err != nil {
+			return nil, err
+		}
+
+		page, err := parseKlines(raw)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, page...)
+
+		if len(raw) < binanceKlineLimit || len(page) == 0 {
+			break
+		}
+		from = page[len(page)-1].Timestamp + granularity
+	}
+
+	return candles, nil
+}
+
+// parseKlines reads rows of
+// [ openTime, "open", "high", "low", "close", "volume", closeTime, ... ]
+// which arrive oldest first.
+func parseKlines(raw [][]json.RawMessage) ([]Candlestick, error) {
+	candles := make([]Candlestick, 0, len(raw))
+	for _, row := range raw {
+		if len(row) < 6 {
+			continue
+		}
+
+		var openTime int64
+		if err := json.Unmarshal(row[0], &openTime); err != nil {
+			return nil, parseError("binance", err)
+		}
+
+		var fields [5]float64
+		for i := range fields {
+			var s string
+			if err := json.Unmarshal(row[i+1], &s); err != nil {
+				return nil, parseError("binance", err)
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, parseError("binance", err)
+			}
+			fields[i] = f
+		}
+
+		candles = append(candles, Candlestick{
+			Timestamp: openTime / 1000,
+			Open:      fields[0],
+			High:      fields[1],
+			Low:       fields[2],
+			Close:     fields[3],
+			Volume:    fields[4],
+		})
+	}
+	return candles, nil
+}
+
+type binanceErrorBody struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (b *BinanceProvider) get(ctx context.Context, path string, params map[string]string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("User-Agent", "Cochart-App")
+
+	res, err := b.Client.Do(req)
+	if err != nil {
+		return requestError("binance", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return binanceError(res)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return parseError("binance", err)
+	}
+	return nil
+}
+
+// binanceError refines errorFromResponse for Binance specifics: 418 means
+// the IP is banned for ignoring 429s and code -1121 is an unknown symbol.
+func binanceError(res *http.Response) *ProviderError {
+	e := errorFromResponse("binance", res)
+
+	switch res.StatusCode {
+	case http.StatusTeapot:
+		e.Kind = ErrRateLimited
+		e.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	case http.StatusBadRequest:
+		var body binanceErrorBody
+		if json.Unmarshal([]byte(e.Message), &body) == nil && body.Code == -1121 {
+			e.Kind = ErrNotFound
+		}
+	}
+	return e
+}
@@ -0,0 +1,150 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// serveFixture writes a recorded upstream response from testdata.
+func serveFixture(t *testing.T, w http.ResponseWriter, name string, status int) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func newBinanceFixture(t *testing.T) *BinanceProvider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/api/v3/exchangeInfo":
+			serveFixture(t, w, "binance/exchangeInfo.json", http.StatusOK)
+		case r.URL.Path == "/api/v3/ticker/24hr":
+			serveFixture(t, w, "binance/ticker_24hr.json", http.StatusOK)
+		case r.URL.Path == "/api/v3/klines" && q.Get("symbol") == "BTCUSDT" && q.Get("interval") == "1h":
+			serveFixture(t, w, "binance/klines_BTCUSDT_1h.json", http.StatusOK)
+		case r.URL.Path == "/api/v3/klines":
+			serveFixture(t, w, "binance/error_invalid_symbol.json", http.StatusBadRequest)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &BinanceProvider{Client: server.Client(), BaseURL: server.URL}
+}
+
+func TestBinanceProductsUseCanonicalSymbols(t *testing.T) {
+	b := newBinanceFixture(t)
+
+	products, err := b.GetProducts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Product{
+		{ID: "BTC/USDT", Name: "BTCUSDT", Type: "crypto", Exchange: "binance", Base: "BTC", Quote: "USDT",
+			PriceIncrement: 0.01, SizeIncrement: 0.00001, MinSize: 0.00001, PricePrecision: 2, SizePrecision: 5,
+			Status: StatusOnline, Spot: true, Margin: true, Volume24h: 1502335720.51234},
+		{ID: "ETH/BTC", Name: "ETHBTC", Type: "crypto", Exchange: "binance", Base: "ETH", Quote: "BTC",
+			PriceIncrement: 0.00001, SizeIncrement: 0.0001, MinSize: 0.0001, PricePrecision: 5, SizePrecision: 4,
+			Status: StatusOnline, Spot: true, Margin: true, Volume24h: 1686.9720135},
+		{ID: "SOL/USDT", Name: "SOLUSDT", Type: "crypto", Exchange: "binance", Base: "SOL", Quote: "USDT",
+			PriceIncrement: 0.01, SizeIncrement: 0.001, MinSize: 0.001, PricePrecision: 2, SizePrecision: 3,
+			Status: StatusHalted, Spot: true},
+	}
+	if len(products) != len(want) {
+		t.Fatalf("got %d products, want %d: %+v", len(products), len(want), products)
+	}
+	for i := range want {
+		if products[i] != want[i] {
+			t.Errorf("product %d = %+v, want %+v", i, products[i], want[i])
+		}
+	}
+
+	if got := b.exchangeSymbol("ETH/BTC"); got != "ETHBTC" {
+		t.Errorf("exchangeSymbol(ETH/BTC) = %q", got)
+	}
+}
+
+func TestBinanceFetchCandles(t *testing.T) {
+	b := newBinanceFixture(t)
+
+	candles, err := b.FetchCandles(context.Background(), "BTC/USDT", 1717999200, 1718006400, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candles) != 3 {
+		t.Fatalf("got %d candles, want 3", len(candles))
+	}
+	first := Candlestick{Timestamp: 1717999200, Open: 69420.01, High: 69551.99, Low: 69380, Close: 69500.1, Volume: 412.8371}
+	if candles[0] != first {
+		t.Errorf("first candle = %+v, want %+v", candles[0], first)
+	}
+	if candles[2].Timestamp != 1718006400 {
+		t.Errorf("last candle at %d, want 1718006400", candles[2].Timestamp)
+	}
+}
+
+func TestBinanceErrors(t *testing.T) {
+	b := newBinanceFixture(t)
+
+	_, err := b.FetchCandles(context.Background(), "NOPE/USDT", 1717999200, 1718006400, 3600)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown symbol: got %v, want ErrNotFound", err)
+	}
+
+	_, err = b.FetchCandles(context.Background(), "BTC/USDT", 1717999200, 1718006400, 604800)
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("weekly interval: got %v, want ErrBadRequest", err)
+	}
+}
+
+func TestBinancePagesKlines(t *testing.T) {
+	const granularity = 60
+	start, end := int64(1_700_000_040), int64(1_700_000_040+2500*granularity)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		from, _ := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64)
+		to, _ := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64)
+
+		var rows [][]any
+		for ts := from; ts <= to && len(rows) < binanceKlineLimit; ts += granularity * 1000 {
+			rows = append(rows, []any{ts, "1", "2", "0.5", "1.5", "10", ts + granularity*1000 - 1})
+		}
+		json.NewEncoder(w).Encode(rows)
+	}))
+	defer server.Close()
+
+	b := &BinanceProvider{Client: server.Client(), BaseURL: server.URL}
+	candles, err := b.FetchCandles(context.Background(), "BTC/USDT", start, end, granularity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candles) != 2501 {
+		t.Fatalf("got %d candles, want 2501", len(candles))
+	}
+	if requests != 3 {
+		t.Errorf("made %d requests, want 3", requests)
+	}
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Timestamp != candles[i-1].Timestamp+granularity {
+			t.Fatalf("candle %d at %d follows %d", i, candles[i].Timestamp, candles[i-1].Timestamp)
+		}
+	}
+}
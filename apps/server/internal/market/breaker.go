@@ -0,0 +1,129 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker stops calls to a provider after Threshold failures in a row. Once
+// Cooldown has passed a single probe is let through: success closes the
+// breaker again, failure keeps it open for another Cooldown.
+type Breaker struct {
+	Provider  string
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probedAt time.Time
+}
+
+func NewBreaker(provider string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Provider: provider, Threshold: threshold, Cooldown: cooldown}
+}
+
+// Allow reports whether a call may go ahead, failing with ErrCircuitOpen if
+// not.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		wait := b.Cooldown - time.Since(b.openedAt)
+		if wait > 0 {
+			return &ProviderError{Provider: b.Provider, Kind: ErrCircuitOpen, RetryAfter: wait}
+		}
+		b.state = BreakerHalfOpen
+		b.probedAt = time.Now()
+		return nil
+	case BreakerHalfOpen:
+		// A probe is already out. Send another if it never reported back.
+		wait := b.Cooldown - time.Since(b.probedAt)
+		if wait > 0 {
+			return &ProviderError{Provider: b.Provider, Kind: ErrCircuitOpen, RetryAfter: wait}
+		}
+		b.probedAt = time.Now()
+		return nil
+	}
+	return nil
+}
+
+// Record feeds the outcome of an allowed call back into the breaker. Calls
+// the caller cancelled say nothing about the provider and are ignored.
+func (b *Breaker) Record(err error) {
+	if b == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !breakerFailure(err) {
+		if b.state != BreakerClosed {
+			log.Printf("Circuit for %s closed", b.Provider)
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		if b.state != BreakerOpen {
+			log.Printf("Circuit for %s opened after %d failures: %v", b.Provider, b.failures, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerFailure tells provider trouble apart from answers about the
+// request itself.
+func breakerFailure(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrBadRequest):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,232 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errUpstream = &ProviderError{Provider: "test", Kind: ErrTransient, StatusCode: 503, RetryAfter: time.Millisecond}
+
+func TestBreakerStates(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	b := NewBreaker("test", 3, cooldown)
+
+	// Closed: failures below the threshold, or broken up by a success, let
+	// calls through
+	for _, err := range []error{errUpstream, errUpstream, nil, errUpstream, errUpstream} {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("closed breaker refused a call: %v", err)
+		}
+		b.Record(err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("got %s after a success reset the count, want closed", b.State())
+	}
+
+	// Answers about the request say nothing about the provider
+	b.Record(&ProviderError{Kind: ErrNotFound})
+	b.Record(context.Canceled)
+	if b.State() != BreakerClosed {
+		t.Fatalf("got %s, want request errors ignored", b.State())
+	}
+
+	// Open: the threshold is reached and calls fail fast
+	b.Record(errUpstream)
+	b.Record(errUpstream)
+	b.Record(errUpstream)
+	err := b.Allow()
+	var perr *ProviderError
+	if b.State() != BreakerOpen || !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &perr) || perr.RetryAfter <= 0 {
+		t.Fatalf("got %s and %v, want open with a retry after", b.State(), err)
+	}
+
+	// Half open: one probe after the cooldown, others wait for it
+	time.Sleep(cooldown)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("no probe after the cooldown: %v", err)
+	}
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("got %s, want half-open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second call let through while probing: %v", err)
+	}
+
+	// Probe fails: straight back to open, however few failures
+	b.Record(errUpstream)
+	if b.State() != BreakerOpen || !errors.Is(b.Allow(), ErrCircuitOpen) {
+		t.Fatalf("got %s, want open after a failed probe", b.State())
+	}
+
+	// Probe times out: a probe that never reports back is replaced after
+	// another cooldown
+	time.Sleep(cooldown)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("no probe after the cooldown: %v", err)
+	}
+	time.Sleep(cooldown)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("lost probe was not replaced: %v", err)
+	}
+
+	// Probe succeeds: closed again
+	b.Record(nil)
+	if b.State() != BreakerClosed || b.Allow() != nil {
+		t.Fatalf("got %s, want closed after a good probe", b.State())
+	}
+}
+
+// failingProvider fails every candle request with err.
+type failingProvider struct {
+	gatedProvider
+	err error
+}
+
+func (p *failingProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	p.calls.Add(1)
+	return nil, p.err
+}
+
+func TestBreakerHearsOncePerBlock(t *testing.T) {
+	provider := &failingProvider{err: errUpstream}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+
+	if _, err := service.FetchCandles(context.Background(), "gated", "X", 0, 60*299, 60); !errors.Is(err, ErrTransient) {
+		t.Fatalf("got %v, want the transient failure", err)
+	}
+	if got := provider.calls.Load(); got != maxAttempts {
+		t.Fatalf("got %d attempts, want %d", got, maxAttempts)
+	}
+
+	b := service.breakers["gated"]
+	b.mu.Lock()
+	failures := b.failures
+	b.mu.Unlock()
+	if failures != 1 {
+		t.Errorf("breaker counted %d failures for one block, want 1", failures)
+	}
+}
+
+func TestBreakerOpensOnStalledProvider(t *testing.T) {
+	provider := &gatedProvider{release: make(chan struct{})}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+	b := service.breakers["gated"]
+
+	failures := func() int {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.failures
+	}
+	// The breaker hears from the shared call after its waiters have left
+	waitForFailures := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for failures() < want {
+			if time.Now().After(deadline) {
+				t.Fatalf("breaker counted %d failures, want %d", failures(), want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A caller hanging up on a stalled block isn't held against upstream
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitForCalls(t, provider, 1)
+		cancel()
+	}()
+	service.FetchCandles(ctx, "gated", "X", 0, 60*299, 60)
+
+	// Blocks running out of time are, even when the waiters' deadlines come
+	// before the shared call's own
+	for i := range defaultBreakerThreshold {
+		start := int64(i+1) * 60 * 300
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err := service.FetchCandles(ctx, "gated", "X", start, start+60*299, 60)
+		cancel()
+		if err == nil {
+			t.Fatal("stalled block succeeded")
+		}
+		waitForFailures(i + 1)
+	}
+
+	if got := provider.calls.Load(); got != defaultBreakerThreshold+1 {
+		t.Errorf("upstream saw %d calls, want %d before the breaker opened", got, defaultBreakerThreshold+1)
+	}
+	if b.State() != BreakerOpen {
+		t.Errorf("breaker %s after %d stalled blocks, want open", b.State(), defaultBreakerThreshold)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	service := NewService(map[string]ExchangeProvider{})
+	service.Failover = []FailoverGroup{{Name: "BTC/USD", Markets: []Market{
+		{"coinbase", "BTC-USD"}, {"kraken", "XBT/USD"}, {"binance", "BTCUSDT"},
+	}}}
+	service.Instruments = newTestRegistry()
+	service.Instruments.Update("binance", []Product{{ID: "ETHUSDT", Base: "ETH", Quote: "USD"}})
+	service.VenueOrder = []string{"kraken", "binance"}
+
+	for _, tc := range []struct {
+		exchange, symbol string
+		want             []Market
+	}{
+		{"kraken", "XBT/USD", []Market{{"kraken", "XBT/USD"}, {"coinbase", "BTC-USD"}, {"binance", "BTCUSDT"}}},
+		{"", "BTC/USD", []Market{{"coinbase", "BTC-USD"}, {"kraken", "XBT/USD"}, {"binance", "BTCUSDT"}}},
+		{"", "btc-usd", []Market{{"coinbase", "BTC-USD"}, {"kraken", "XBT/USD"}, {"binance", "BTCUSDT"}}},
+		{"coinbase", "ETH-USD", []Market{{"coinbase", "ETH-USD"}}},
+		// No group: the preferred venue alone, no failover
+		{"", "eth-usd", []Market{{"binance", "ETHUSDT"}}},
+		{"kraken", "ETH/USD", []Market{{"kraken", "ETH/USD"}}},
+	} {
+		got := service.route(tc.exchange, tc.symbol)
+		if len(got) != len(tc.want) {
+			t.Errorf("route(%q, %q) = %v, want %v", tc.exchange, tc.symbol, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("route(%q, %q) = %v, want %v", tc.exchange, tc.symbol, got, tc.want)
+				break
+			}
+		}
+	}
+}
+
+func TestWithFailover(t *testing.T) {
+	primary := &failingProvider{err: errUpstream}
+	missing := &failingProvider{err: &ProviderError{Provider: "missing", Kind: ErrNotFound}}
+	backup := &gatedProvider{release: make(chan struct{})}
+	close(backup.release)
+
+	service := NewService(map[string]ExchangeProvider{"primary": primary, "missing": missing, "backup": backup})
+	service.Failover = []FailoverGroup{
+		{Name: "X/USD", Markets: []Market{{"primary", "X"}, {"gone", "X"}, {"backup", "X"}}},
+		{Name: "Y/USD", Markets: []Market{{"missing", "Y"}, {"backup", "Y"}}},
+	}
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	fetch := func(m Market) error {
+		calls.Add(1)
+		_, err := service.FetchCandles(ctx, m.Exchange, m.Symbol, 0, 60*299, 60)
+		return err
+	}
+
+	source, err := service.withFailover(ctx, "primary", "X", fetch)
+	if err != nil || source != (Market{"backup", "X"}) {
+		t.Errorf("got %v from %s, want the backup to serve", err, source)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("fetched %d times, want primary then backup skipping the unknown exchange", calls.Load())
+	}
+
+	// Not found would be not found anywhere, so no failover
+	source, err = service.withFailover(ctx, "missing", "Y", fetch)
+	if !errors.Is(err, ErrNotFound) || source != (Market{"missing", "Y"}) {
+		t.Errorf("got %v from %s, want not found from the first market", err, source)
+	}
+}
@@ -1,58 +1,201 @@
 package market
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	defaultCacheBytes = 256 << 20
+	// recentBlockTTL bounds how stale a block that overlaps the present can get
+	recentBlockTTL = 30 * time.Second
+	// candleBytes approximates the in-memory size of one cached candle
+	candleBytes = 48
+)
+
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Bytes       int64
+	Entries     int
+}
+
+// candleCache is a byte bounded LRU of candle blocks. Blocks that are fully
+// in the past never expire; blocks still forming expire after recentBlockTTL.
+type candleCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	ll       *list.List
+	items    map[string]*list.Element
+	stats    CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	data    []Candlestick
+	size    int64
+	expires time.Time
+}
+
+func newCandleCache(maxBytes int64) *candleCache {
+	return &candleCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *candleCache) get(key string, now time.Time) ([]Candlestick, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		c.remove(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return entry.data, true
+}
+
+func (c *candleCache) put(key string, data []Candlestick, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	size := int64(len(key) + len(data)*candleBytes)
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if size > c.maxBytes {
+		return
+	}
+
+	entry := &cacheEntry{key: key, data: data, size: size, expires: expires}
+	c.items[key] = c.ll.PushFront(entry)
+	c.stats.Bytes += size
+	c.stats.Entries++
+
+	for c.stats.Bytes > c.maxBytes {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops an element. Must be called with c.mu held.
+func (c *candleCache) remove(el *list.Element) {
+	entry := c.ll.Remove(el).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.stats.Bytes -= entry.size
+	c.stats.Entries--
+}
+
+func (c *candleCache) pruneExpired(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pruned := 0
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		entry := el.Value.(*cacheEntry)
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			c.remove(el)
+			c.stats.Expirations++
+			pruned++
+		}
+		el = prev
+	}
+	return pruned
+}
+
+func cacheKey(symbol, exchange, series string, start int64) string {
+	return fmt.Sprintf("%s-%s-%s-%d", symbol, exchange, series, start)
+}
+
 func (s *Service) GetFromCache(ctx context.Context, symbol, exchange string, start, granularity int64) []Candlestick {
-	s.cacheMx.RLock()
-	cacheKey := fmt.Sprintf("%s-%s-%d-%d", symbol, exchange, granularity, start)
-	candles, exists := s.cache[cacheKey]
-	s.cacheMx.RUnlock()
+	return s.getCached(cacheKey(symbol, exchange, strconv.FormatInt(granularity, 10), start))
+}
 
-	if exists {
-		return candles.Data
+func (s *Service) SaveToCache(ctx context.Context, symbol, exchange string, start, granularity int64, candles []Candlestick) {
+	end := start + granularity*int64(s.capabilities(exchange).blockSize())
+	s.putCached(cacheKey(symbol, exchange, strconv.FormatInt(granularity, 10), start), candles, end, granularity)
+}
+
+func (s *Service) getCached(cacheKey string) []Candlestick {
+	if candles, ok := s.cache.get(cacheKey, time.Now()); ok {
+		return candles
 	}
 	return []Candlestick{}
 }
 
-func (s *Service) SaveToCache(ctx context.Context, symbol, exchange string, start, granularity int64, candles []Candlestick) {
-	s.cacheMx.Lock()
-	cacheKey := fmt.Sprintf("%s-%s-%d-%d", symbol, exchange, granularity, start)
-	s.cache[cacheKey] = CacheCandleBatch{candles, time.Now()}
-	s.cacheMx.Unlock()
+// putCached stores a block ending at blockEnd made of granularity candles.
+// Only settled blocks are kept without a TTL, as upstream may still revise
+// a block that has only just ended.
+func (s *Service) putCached(cacheKey string, candles []Candlestick, blockEnd, granularity int64) {
+	now := time.Now()
+
+	var expires time.Time
+	if !blockSettled(blockEnd, granularity, now.Unix()) {
+		expires = now.Add(recentBlockTTL)
+	}
+	s.cache.put(cacheKey, candles, expires)
+}
+
+// blockSettled reports whether a block ending at blockEnd is final upstream.
+// An exchange publishes a candle once its bucket is over, so the last candle
+// of the block is only certain one granularity after the block ends.
+func blockSettled(blockEnd, granularity, now int64) bool {
+	return blockEnd+granularity <= now
+}
+
+// CacheStats reports the in-memory candle cache counters.
+func (s *Service) CacheStats() CacheStats {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	return s.cache.stats
 }
 
-func (s *Service) StartCachePruner(ctx context.Context, ttl time.Duration) {
+func (s *Service) StartCachePruner(ctx context.Context, interval time.Duration) {
 	log.Println("Starting cache pruner")
-	ticker := time.NewTicker(ttl)
-	defer ticker.Stop()
+	ticker := time.NewTicker(interval)
 
 	go func() {
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				s.PruneCache(ttl)
+				s.PruneCache()
 			}
 		}
 
 	}()
 }
 
-func (s *Service) PruneCache(ttl time.Duration) {
-	s.cacheMx.Lock()
-	defer s.cacheMx.Unlock()
-
-	log.Println("Pruning cache")
-	now := time.Now()
-	for k, v := range s.cache {
-		if now.Sub(v.CreatedAt) > ttl {
-			delete(s.cache, k)
-		}
+// PruneCache drops expired blocks ahead of the LRU getting to them.
+func (s *Service) PruneCache() {
+	pruned := s.cache.pruneExpired(time.Now())
+	if pruned == 0 {
+		return
 	}
+	stats := s.CacheStats()
+	log.Printf("Pruned %d cache blocks (entries: %d, bytes: %d, hits: %d, misses: %d, evictions: %d)",
+		pruned, stats.Entries, stats.Bytes, stats.Hits, stats.Misses, stats.Evictions)
 }
@@ -0,0 +1,117 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func cacheBlock(n int) []Candlestick {
+	return make([]Candlestick, n)
+}
+
+func TestCandleCacheLRU(t *testing.T) {
+	// Room for two of the ten candle blocks below, not three
+	entry := int64(len("a") + 10*candleBytes)
+	c := newCandleCache(2*entry + entry/2)
+	now := time.Now()
+
+	c.put("a", cacheBlock(10), time.Time{})
+	c.put("b", cacheBlock(10), time.Time{})
+	if _, ok := c.get("a", now); !ok {
+		t.Fatal("a missing")
+	}
+
+	// b is now the least recently used
+	c.put("c", cacheBlock(10), time.Time{})
+	if _, ok := c.get("b", now); ok {
+		t.Error("least recently used block survived")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key, now); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	stats := c.stats
+	if stats.Entries != 2 || stats.Bytes != 2*entry || stats.Evictions != 1 {
+		t.Errorf("got %+v, want 2 entries of %d bytes after one eviction", stats, 2*entry)
+	}
+	if stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("got %d hits and %d misses, want 3 and 1", stats.Hits, stats.Misses)
+	}
+}
+
+func TestCandleCacheReplaceAndOversize(t *testing.T) {
+	c := newCandleCache(int64(len("a") + 10*candleBytes))
+
+	c.put("a", cacheBlock(5), time.Time{})
+	c.put("a", cacheBlock(10), time.Time{})
+	if got, ok := c.get("a", time.Now()); !ok || len(got) != 10 {
+		t.Errorf("got %d candles, want the replacement", len(got))
+	}
+	if c.stats.Entries != 1 || c.stats.Bytes != int64(len("a")+10*candleBytes) {
+		t.Errorf("replacing left %+v", c.stats)
+	}
+
+	// A block bigger than the whole cache is not kept, and does not flush
+	// everything else trying to fit
+	c.put("b", cacheBlock(11), time.Time{})
+	if _, ok := c.get("b", time.Now()); ok {
+		t.Error("oversized block was cached")
+	}
+	if _, ok := c.get("a", time.Now()); !ok {
+		t.Error("oversized block evicted a")
+	}
+}
+
+func TestCandleCacheExpiry(t *testing.T) {
+	c := newCandleCache(1 << 20)
+	now := time.Now()
+
+	c.put("recent", cacheBlock(1), now.Add(time.Minute))
+	c.put("closed", cacheBlock(1), time.Time{})
+	c.put("stale", cacheBlock(1), now.Add(-time.Second))
+
+	if _, ok := c.get("recent", now); !ok {
+		t.Error("unexpired block missing")
+	}
+	if _, ok := c.get("stale", now); ok {
+		t.Error("expired block returned")
+	}
+
+	if pruned := c.pruneExpired(now.Add(2 * time.Minute)); pruned != 1 {
+		t.Errorf("pruned %d blocks, want the recent one", pruned)
+	}
+	if _, ok := c.get("closed", now.Add(24*time.Hour)); !ok {
+		t.Error("block without a TTL expired")
+	}
+	if c.stats.Expirations != 2 {
+		t.Errorf("got %d expirations, want 2", c.stats.Expirations)
+	}
+}
+
+func TestPutCachedOnlyKeepsSettledBlocks(t *testing.T) {
+	s := NewService(map[string]ExchangeProvider{})
+	now := time.Now().Unix()
+
+	for _, tc := range []struct {
+		name     string
+		blockEnd int64
+		forever  bool
+	}{
+		{"forming", now + 60, false},
+		{"just ended", now - 30, false},
+		{"settled", now - 60, true},
+		{"long past", now - 86400, true},
+	} {
+		s.putCached(tc.name, cacheBlock(1), tc.blockEnd, 60)
+
+		el := s.cache.items[tc.name]
+		if el == nil {
+			t.Fatalf("%s block was not cached", tc.name)
+		}
+		if forever := el.Value.(*cacheEntry).expires.IsZero(); forever != tc.forever {
+			t.Errorf("%s block kept forever = %v, want %v", tc.name, forever, tc.forever)
+		}
+	}
+}
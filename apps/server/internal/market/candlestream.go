@@ -0,0 +1,203 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CandleChunk is one contiguous, time ordered piece of a streamed candle
+// request along with how far the request has progressed. A block that could
+// not be fetched arrives as a chunk with no candles and a fetch_failed gap.
+type CandleChunk struct {
+	Candles   []Candlestick `json:"candles"`
+	Gaps      []Gap         `json:"gaps,omitempty"`
+	Start     int64         `json:"start"`
+	End       int64         `json:"end"`
+	Completed int           `json:"completed"`
+	Total     int           `json:"total"`
+	Done      bool          `json:"done"`
+}
+
+// maxConcurrentResampledBlocks bounds how many resampled blocks a stream
+// builds at once. Each one already fetches its native blocks concurrently.
+const maxConcurrentResampledBlocks = 3
+
+// StreamCandles fetches the same range as FetchCandles but hands each block
+// to emit as soon as it and every block before it have arrived. Failed
+// blocks are streamed as gaps, like FetchTimeframePartial reports them, and
+// the stream only fails when no block could be fetched, before anything is
+// emitted. Returning an error from emit, or cancelling ctx, stops all
+// outstanding upstream calls.
+func (s *Service) StreamCandles(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe, emit func(CandleChunk) error) error {
+	if _, exists := s.Providers[exchangeName]; !exists {
+		return fmt.Errorf("exchange %s not found", exchangeName)
+	}
+
+	if !s.isNative(exchangeName, tf) {
+		return s.streamResampled(ctx, exchangeName, symbol, start, end, tf, emit)
+	}
+	granularity := tf.Seconds
+
+	provider, blocks, err := s.plan(exchangeName, start, end, granularity)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if len(blocks) == 0 {
+		return emit(CandleChunk{Candles: []Candlestick{}, Start: start, End: end, Done: true})
+	}
+
+	// No overall deadline here: long ranges are the reason to stream, and
+	// every upstream block fetch is already bounded by BlockTimeout.
+	responses := s.fetchBlocks(ctx, provider, exchangeName, symbol, granularity, blocks)
+
+	return emitInOrder(ctx, responses, len(blocks), func(res CandleResponse) CandleChunk {
+		b := blocks[res.Index]
+		chunkStart, chunkEnd := max(b.Start, start), b.End
+		if res.Index < len(blocks)-1 {
+			chunkEnd = blocks[res.Index+1].Start - 1
+		}
+
+		if res.Error != nil {
+			return failedChunk(chunkStart, chunkEnd, res.Error)
+		}
+		candles := s.finishCandles(res.Data, exchangeName, symbol, chunkStart, chunkEnd, granularity)
+		return CandleChunk{
+			Candles: candles,
+			Gaps:    noDataGaps(candles, span{chunkStart, chunkEnd}, tf, time.Now().Unix()),
+			Start:   chunkStart,
+			End:     chunkEnd,
+		}
+	}, emit)
+}
+
+// streamResampled builds resampled cache blocks a few at a time and emits
+// them in order.
+func (s *Service) streamResampled(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe, emit func(CandleChunk) error) error {
+	var blocks []int64
+	for block := tf.blockStart(start); block <= end; block = tf.blockEnd(block) {
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return emit(CandleChunk{Candles: []Candlestick{}, Start: start, End: end, Done: true})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	responses := make(chan CandleResponse, len(blocks))
+	sem := make(chan struct{}, maxConcurrentResampledBlocks)
+	var wg sync.WaitGroup
+	for i, block := range blocks {
+		wg.Add(1)
+		go func(i int, block int64) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				responses <- CandleResponse{Index: i, Error: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+
+			candles, err := s.resampledBlock(ctx, exchangeName, symbol, block, end, tf)
+			responses <- CandleResponse{Data: candles, Index: i, Error: err}
+		}(i, block)
+	}
+	go func() {
+		wg.Wait()
+		close(responses)
+	}()
+
+	first := tf.BucketStart(start)
+	return emitInOrder(ctx, responses, len(blocks), func(res CandleResponse) CandleChunk {
+		block := blocks[res.Index]
+		chunkStart, chunkEnd := max(block, first), min(tf.blockEnd(block)-1, end)
+
+		if res.Error != nil {
+			return failedChunk(chunkStart, chunkEnd, res.Error)
+		}
+		candles := make([]Candlestick, 0, len(res.Data))
+		for _, c := range res.Data {
+			if c.Timestamp >= first && c.Timestamp <= end {
+				candles = append(candles, c)
+			}
+		}
+		return CandleChunk{
+			Candles: candles,
+			Gaps:    noDataGaps(candles, span{chunkStart, chunkEnd}, tf, time.Now().Unix()),
+			Start:   chunkStart,
+			End:     chunkEnd,
+		}
+	}, emit)
+}
+
+// emitInOrder turns block responses into chunks and emits them in block
+// order as soon as each is next. Failures before the first success are held
+// back, so a stream where every block failed emits nothing and returns the
+// first failure instead.
+func emitInOrder(ctx context.Context, responses <-chan CandleResponse, total int, chunk func(CandleResponse) CandleChunk, emit func(CandleChunk) error) error {
+	pending := make(map[int]CandleResponse)
+	var held []CandleChunk
+	var firstErr error
+	next, fetched := 0, 0
+
+	for res := range responses {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		pending[res.Index] = res
+
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			c := chunk(res)
+			c.Completed, c.Total, c.Done = next, total, next == total
+			if res.Error != nil {
+				if firstErr == nil {
+					firstErr = res.Error
+				}
+			} else {
+				fetched++
+			}
+
+			if fetched == 0 {
+				held = append(held, c)
+				continue
+			}
+			for _, h := range append(held, c) {
+				if err := emit(h); err != nil {
+					return err
+				}
+			}
+			held = nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if fetched == 0 {
+		return fmt.Errorf("every block failed, first: %w", firstErr)
+	}
+	return nil
+}
+
+func failedChunk(start, end int64, err error) CandleChunk {
+	return CandleChunk{
+		Candles: []Candlestick{},
+		Gaps:    []Gap{{Start: start, End: end, Kind: GapFetchFailed, Reason: err.Error()}},
+		Start:   start,
+		End:     end,
+	}
+}
@@ -0,0 +1,171 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockProvider holds each block until its gate is released and fails the
+// blocks listed in fail.
+type blockProvider struct {
+	gatedProvider
+	gates map[int64]chan struct{}
+	fail  map[int64]error
+}
+
+func (p *blockProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	if gate, ok := p.gates[start]; ok {
+		select {
+		case <-gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if err := p.fail[start]; err != nil {
+		return nil, err
+	}
+
+	var candles []Candlestick
+	for t := start; t <= end; t += granularity {
+		candles = append(candles, Candlestick{Timestamp: t, Open: 1, High: 1, Low: 1, Close: 1})
+	}
+	return candles, nil
+}
+
+// Three blocks of 300 minutes
+const streamBlock = 60 * 300
+
+func streamChunks(t *testing.T, service *Service, tf Timeframe, end int64) (<-chan CandleChunk, <-chan error) {
+	t.Helper()
+	chunks := make(chan CandleChunk, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- service.StreamCandles(context.Background(), "gated", "X", 0, end, tf, func(c CandleChunk) error {
+			chunks <- c
+			return nil
+		})
+		close(chunks)
+	}()
+	return chunks, done
+}
+
+func TestStreamCandlesInOrderAsSoonAsReady(t *testing.T) {
+	provider := &blockProvider{gates: map[int64]chan struct{}{
+		0:               make(chan struct{}),
+		streamBlock:     make(chan struct{}),
+		2 * streamBlock: make(chan struct{}),
+	}}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+	chunks, done := streamChunks(t, service, Timeframes["1m"], 3*streamBlock-60)
+
+	expect := func(want ...int) {
+		t.Helper()
+		for _, i := range want {
+			select {
+			case c := <-chunks:
+				if c.Start != int64(i)*streamBlock || c.Completed != i+1 || c.Total != 3 || c.Done != (i == 2) {
+					t.Fatalf("got chunk %d-%d (%d of %d), want block %d", c.Start, c.End, c.Completed, c.Total, i)
+				}
+				if len(c.Candles) != 300 {
+					t.Errorf("block %d has %d candles", i, len(c.Candles))
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("block %d wasn't emitted", i)
+			}
+		}
+		select {
+		case c, ok := <-chunks:
+			if ok {
+				t.Fatalf("block at %d was emitted early", c.Start)
+			}
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	// The last block waits for the ones before it, the first goes out
+	// without waiting for the rest
+	close(provider.gates[2*streamBlock])
+	expect()
+	close(provider.gates[0])
+	expect(0)
+	close(provider.gates[streamBlock])
+	expect(1, 2)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamCandlesFailedBlocksBecomeGaps(t *testing.T) {
+	bad := &ProviderError{Provider: "gated", Kind: ErrBadRequest, Message: "bad block"}
+	provider := &blockProvider{fail: map[int64]error{0: bad, streamBlock: bad}}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+	chunks, done := streamChunks(t, service, Timeframes["1m"], 3*streamBlock-60)
+
+	var got []CandleChunk
+	for c := range chunks {
+		got = append(got, c)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures ahead of the first success are held until it arrives, but
+	// still come first
+	if len(got) != 3 {
+		t.Fatalf("got %d chunks, want 3", len(got))
+	}
+	for i, c := range got[:2] {
+		if len(c.Candles) != 0 || len(c.Gaps) != 1 || c.Gaps[0].Kind != GapFetchFailed || c.Gaps[0].Start != c.Start || c.Gaps[0].End != c.End {
+			t.Errorf("chunk %d = %+v, want one fetch_failed gap over it", i, c)
+		}
+	}
+	if last := got[2]; len(last.Candles) != 300 || len(last.Gaps) != 0 || !last.Done {
+		t.Errorf("last chunk has %d candles and gaps %+v", len(last.Candles), last.Gaps)
+	}
+}
+
+func TestStreamCandlesFailsWhenEveryBlockFails(t *testing.T) {
+	provider := &blockProvider{fail: map[int64]error{
+		0:           &ProviderError{Provider: "gated", Kind: ErrNotFound},
+		streamBlock: &ProviderError{Provider: "gated", Kind: ErrNotFound},
+	}}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+	chunks, done := streamChunks(t, service, Timeframes["1m"], 2*streamBlock-60)
+
+	for c := range chunks {
+		t.Errorf("emitted chunk %d-%d", c.Start, c.End)
+	}
+	if err := <-done; !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want not found", err)
+	}
+}
+
+func TestStreamResampledInOrder(t *testing.T) {
+	service := NewService(map[string]ExchangeProvider{"gated": &historyProvider{}})
+	tf := Timeframes["15m"]
+	start := tf.blockStart(utc(2024, 6, 1, 0, 0))
+	end := start + 3*300*tf.Seconds - 1
+
+	var got []CandleChunk
+	err := service.StreamCandles(context.Background(), "gated", "X", start, end, tf, func(c CandleChunk) error {
+		got = append(got, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 || !got[2].Done {
+		t.Fatalf("got %d chunks, want 3 ending with done", len(got))
+	}
+	next := start
+	for i, c := range got {
+		if c.Start != next || c.Completed != i+1 || len(c.Candles) != 300 {
+			t.Errorf("chunk %d starts %d (%d done) with %d candles, want %d", i, c.Start, c.Completed, len(c.Candles), next)
+		}
+		next = c.End + 1
+	}
+}
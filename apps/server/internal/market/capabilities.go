@@ -0,0 +1,125 @@
+package market
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Capabilities describes what a provider can serve. HistoryStart is the
+// earliest time any of its markets has data, or zero when unknown.
+// MaxHistoryCandles, when set, is a rolling window instead: only that many
+// of the most recent candles of each granularity are served, so the earliest
+// candle moves forward with the clock. Volatile providers can rewrite
+// history, so their blocks are never cached or stored. Generated providers
+// make their data up from settings that may change between runs, so their
+// blocks are cached but never stored.
+type Capabilities struct {
+	Granularities        []int64  `json:"granularities"`
+	MaxCandlesPerRequest int      `json:"maxCandlesPerRequest"`
+	HistoryStart         int64    `json:"historyStart,omitempty"`
+	MaxHistoryCandles    int      `json:"maxHistoryCandles,omitempty"`
+	AssetTypes           []string `json:"assetTypes"`
+	Volatile             bool     `json:"volatile,omitempty"`
+	Generated            bool     `json:"generated,omitempty"`
+}
+
+const defaultCandlesPerRequest = 300
+
+func (c Capabilities) blockSize() int {
+	if c.MaxCandlesPerRequest > 0 {
+		return c.MaxCandlesPerRequest
+	}
+	return defaultCandlesPerRequest
+}
+
+// historyStart is the earliest granularity candle that can be fetched at
+// now.
+func (c Capabilities) historyStart(granularity, now int64) int64 {
+	start := c.HistoryStart
+	if c.MaxHistoryCandles > 0 {
+		current := floorDiv(now, granularity) * granularity
+		start = max(start, current-int64(c.MaxHistoryCandles-1)*granularity)
+	}
+	return start
+}
+
+func (c Capabilities) supports(granularity int64) bool {
+	for _, g := range c.Granularities {
+		if g == granularity {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) capabilities(exchangeName string) Capabilities {
+	if provider, ok := s.Providers[exchangeName]; ok {
+		return provider.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// plan checks a native candle request against the provider's capabilities
+// and splits it into blocks of at most one upstream request each.
+func (s *Service) plan(exchangeName string, start, end, granularity int64) (ExchangeProvider, []candleBlock, error) {
+	provider, exists := s.Providers[exchangeName]
+	if !exists {
+		return nil, nil, fmt.Errorf("exchange %s not found", exchangeName)
+	}
+
+	caps := provider.Capabilities()
+	if !caps.supports(granularity) {
+		return nil, nil, fmt.Errorf("%w: %s does not serve %ds candles", ErrBadRequest, exchangeName, granularity)
+	}
+
+	start = max(start, caps.historyStart(granularity, time.Now().Unix()))
+	return provider, planBlocks(start, end, granularity, caps.blockSize()), nil
+}
+
+func (s *Service) isNative(exchangeName string, tf Timeframe) bool {
+	return tf.Fixed() && s.capabilities(exchangeName).supports(tf.Seconds)
+}
+
+// baseGranularity picks the coarsest native granularity that tiles every
+// bucket of tf exactly.
+func (s *Service) baseGranularity(exchangeName string, tf Timeframe) (int64, error) {
+	var best int64
+	for _, g := range s.capabilities(exchangeName).Granularities {
+		var fits bool
+		if tf.Months > 0 {
+			fits = day%g == 0
+		} else {
+			fits = tf.Seconds%g == 0 && tf.Offset%g == 0
+		}
+		if fits && g > best {
+			best = g
+		}
+	}
+
+	if best == 0 {
+		return 0, fmt.Errorf("%w: %s can't build %s candles", ErrBadRequest, exchangeName, tf.Label)
+	}
+	return best, nil
+}
+
+// SupportedTimeframes lists every timeframe a provider can serve, natively
+// or by resampling, shortest first.
+func (s *Service) SupportedTimeframes(exchangeName string) []string {
+	var supported []Timeframe
+	for _, tf := range Timeframes {
+		if _, err := s.baseGranularity(exchangeName, tf); err == nil {
+			supported = append(supported, tf)
+		}
+	}
+
+	sort.Slice(supported, func(i, j int) bool {
+		return supported[i].Nominal() < supported[j].Nominal()
+	})
+
+	labels := make([]string, len(supported))
+	for i, tf := range supported {
+		labels[i] = tf.Label
+	}
+	return labels
+}
@@ -0,0 +1,185 @@
+// Package cassette records HTTP exchanges to a file and plays them back, so
+// provider code can be tested offline against real payloads.
+//
+// Inject a cassette as the http.Client of any provider. In record mode
+// requests go upstream and their responses are captured; in replay mode
+// the captured responses are served and nothing touches the network.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type Mode int
+
+const (
+	Replay Mode = iota
+	Record
+)
+
+// ErrNoInteraction is returned in replay mode for a request that was never
+// recorded.
+var ErrNoInteraction = errors.New("cassette: no recorded interaction")
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Cassette is an http.RoundTripper backed by a fixture file. Requests match
+// on method and URL, with query parameters in any order. Repeated requests
+// are answered in recorded order and the last answer repeats after that.
+type Cassette struct {
+	Path string
+	Mode Mode
+	// Next carries requests upstream while recording
+	Next http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	served       map[string]int
+}
+
+// Open loads the cassette at path for replay, or starts a fresh recording
+// when the CASSETTE environment variable is "record".
+func Open(path string) (*Cassette, error) {
+	if os.Getenv("CASSETTE") == "record" {
+		return New(path, Record)
+	}
+	return New(path, Replay)
+}
+
+func New(path string, mode Mode) (*Cassette, error) {
+	c := &Cassette{Path: path, Mode: mode, Next: http.DefaultTransport, served: make(map[string]int)}
+	if mode == Record {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Client returns an http.Client that goes through the cassette.
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{Transport: c}
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	if c.Mode == Record {
+		return c.record(req)
+	}
+	return c.replay(req)
+}
+
+func (c *Cassette) replay(req *http.Request) (*http.Response, error) {
+	key := requestKey(req.Method, req.URL)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []Interaction
+	for _, i := range c.interactions {
+		u, err := url.Parse(i.Request.URL)
+		if err == nil && requestKey(i.Request.Method, u) == key {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoInteraction, req.Method, req.URL)
+	}
+
+	n := c.served[key]
+	c.served[key]++
+	return matches[min(n, len(matches)-1)].Response.build(req), nil
+}
+
+func (c *Cassette) record(req *http.Request) (*http.Response, error) {
+	res, err := c.Next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := res.Header.Clone()
+	header.Del("Set-Cookie")
+	recorded := Response{Status: res.StatusCode, Header: header, Body: string(body)}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{
+		Request:  Request{Method: req.Method, URL: req.URL.String()},
+		Response: recorded,
+	})
+	c.mu.Unlock()
+
+	return recorded.build(req), nil
+}
+
+// Save writes everything recorded so far to Path. It does nothing in replay
+// mode.
+func (c *Cassette) Save() error {
+	if c.Mode != Record {
+		return nil
+	}
+
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.Path, append(data, '\n'), 0o644)
+}
+
+func (r Response) build(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// requestKey identifies a request regardless of query parameter order.
+func requestKey(method string, u *url.URL) string {
+	return method + " " + u.Scheme + "://" + u.Host + u.Path + "?" + u.Query().Encode()
+}
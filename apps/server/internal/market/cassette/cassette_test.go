@@ -0,0 +1,67 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	recorder, err := New(path, Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		get(t, recorder.Client(), server.URL+"/products?b=2&a=1")
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	player, err := New(path, Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Query order doesn't matter and answers come back in recorded order,
+	// the last one repeating
+	for _, want := range []string{`{"call":1}`, `{"call":2}`, `{"call":2}`} {
+		if got := get(t, player.Client(), server.URL+"/products?a=1&b=2"); got != want {
+			t.Errorf("replayed %s, want %s", got, want)
+		}
+	}
+
+	_, err = player.Client().Get(server.URL + "/other")
+	if !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("unrecorded request: got %v, want ErrNoInteraction", err)
+	}
+}
+
+func get(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
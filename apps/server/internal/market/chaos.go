@@ -0,0 +1,214 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChaosConfig sets how often each kind of fault is injected. Rates are
+// probabilities per call between 0 and 1.
+type ChaosConfig struct {
+	Seed uint64
+	// Latency is added to every call, plus up to Jitter more
+	Latency time.Duration
+	Jitter  time.Duration
+
+	ErrorRate     float64
+	RateLimitRate float64
+	RetryAfter    time.Duration
+	HangRate      float64
+	// Response faults: drop a tail of the candles, repeat some of them or
+	// return them out of order
+	TruncateRate  float64
+	DuplicateRate float64
+	ShuffleRate   float64
+}
+
+// ChaosProvider wraps a provider and injects faults into its responses. The
+// faults for a call depend only on Seed, the request and how many times it
+// has been made, so a failing run can be reproduced exactly.
+type ChaosProvider struct {
+	ExchangeProvider
+	Config ChaosConfig
+
+	mu    sync.Mutex
+	calls map[string]uint64
+}
+
+func NewChaosProvider(provider ExchangeProvider, config ChaosConfig) *ChaosProvider {
+	return &ChaosProvider{ExchangeProvider: provider, Config: config, calls: make(map[string]uint64)}
+}
+
+// WithChaos wraps every provider in the map with the same config.
+func WithChaos(providers map[string]ExchangeProvider, config ChaosConfig) map[string]ExchangeProvider {
+	wrapped := make(map[string]ExchangeProvider, len(providers))
+	for name, p := range providers {
+		wrapped[name] = NewChaosProvider(p, config)
+	}
+	return wrapped
+}
+
+// Capabilities marks the provider volatile while response faults are on, so
+// mangled candles are never cached or stored.
+func (c *ChaosProvider) Capabilities() Capabilities {
+	caps := c.ExchangeProvider.Capabilities()
+	cfg := c.Config
+	if cfg.TruncateRate > 0 || cfg.DuplicateRate > 0 || cfg.ShuffleRate > 0 {
+		caps.Volatile = true
+	}
+	return caps
+}
+
+// GetProducts has no context to give up on, so listings never hang. They
+// still get the latency and errors.
+func (c *ChaosProvider) GetProducts() ([]Product, error) {
+	roll := c.roll("products")
+	if err := c.fault(context.Background(), roll, false); err != nil {
+		return nil, err
+	}
+	return c.ExchangeProvider.GetProducts()
+}
+
+func (c *ChaosProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	roll := c.roll(fmt.Sprintf("candles-%s-%d-%d-%d", symbol, start, end, granularity))
+	if err := c.fault(ctx, roll, true); err != nil {
+		return nil, err
+	}
+
+	candles, err := c.ExchangeProvider.FetchCandles(ctx, symbol, start, end, granularity)
+	if err != nil || len(candles) == 0 {
+		return candles, err
+	}
+	candles = append([]Candlestick(nil), candles...)
+
+	cfg := c.Config
+	if roll.next() < cfg.TruncateRate {
+		candles = candles[:int(roll.next()*float64(len(candles)))]
+	}
+	if roll.next() < cfg.DuplicateRate {
+		for i := len(candles) - 1; i >= 0; i-- {
+			if roll.next() < 0.25 {
+				candles = append(candles, candles[i])
+			}
+		}
+	}
+	if roll.next() < cfg.ShuffleRate {
+		for i := len(candles) - 1; i > 0; i-- {
+			j := int(roll.next() * float64(i+1))
+			candles[i], candles[j] = candles[j], candles[i]
+		}
+	}
+	return candles, nil
+}
+
+// fault waits out the injected latency and decides whether the call fails
+// before reaching the wrapped provider. Calls that can't hang still draw the
+// hang roll, so the rest of the sequence doesn't shift.
+func (c *ChaosProvider) fault(ctx context.Context, roll *chaosRoll, canHang bool) error {
+	cfg := c.Config
+	delay := cfg.Latency + time.Duration(roll.next()*float64(cfg.Jitter))
+	if roll.next() < cfg.HangRate && canHang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	if delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	id := c.ID()
+	switch u := roll.next(); {
+	case u < cfg.RateLimitRate:
+		return &ProviderError{Provider: id, Kind: ErrRateLimited, StatusCode: 429, RetryAfter: cfg.RetryAfter, Message: "chaos"}
+	case u < cfg.RateLimitRate+cfg.ErrorRate:
+		return &ProviderError{Provider: id, Kind: ErrTransient, StatusCode: 503, Message: "chaos"}
+	}
+	return nil
+}
+
+// roll starts the random sequence for the nth call of a request.
+func (c *ChaosProvider) roll(request string) *chaosRoll {
+	c.mu.Lock()
+	if c.calls == nil {
+		c.calls = make(map[string]uint64)
+	}
+	n := c.calls[request]
+	c.calls[request]++
+	c.mu.Unlock()
+
+	h := fnv.New64a()
+	h.Write([]byte(request))
+	return &chaosRoll{state: c.Config.Seed ^ splitmix(h.Sum64()^splitmix(n))}
+}
+
+type chaosRoll struct {
+	state uint64
+}
+
+// next returns the following uniform number in [0, 1).
+func (r *chaosRoll) next() float64 {
+	r.state = splitmix(r.state)
+	return float64(r.state>>11) / (1 << 53)
+}
+
+// ParseChaosConfig reads a spec such as
+// "seed=7,latency=200ms,jitter=1s,error=0.1,429=0.05,hang=0.01,truncate=0.1,duplicate=0.1,shuffle=0.1".
+func ParseChaosConfig(spec string) (ChaosConfig, error) {
+	var cfg ChaosConfig
+	rates := map[string]*float64{
+		"error":     &cfg.ErrorRate,
+		"429":       &cfg.RateLimitRate,
+		"hang":      &cfg.HangRate,
+		"truncate":  &cfg.TruncateRate,
+		"duplicate": &cfg.DuplicateRate,
+		"shuffle":   &cfg.ShuffleRate,
+	}
+	durations := map[string]*time.Duration{
+		"latency":    &cfg.Latency,
+		"jitter":     &cfg.Jitter,
+		"retryafter": &cfg.RetryAfter,
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return cfg, fmt.Errorf("chaos: expected key=value, got %q", part)
+		}
+		key = strings.ToLower(key)
+
+		var err error
+		switch {
+		case key == "seed":
+			cfg.Seed, err = strconv.ParseUint(value, 10, 64)
+		case rates[key] != nil:
+			*rates[key], err = strconv.ParseFloat(value, 64)
+		case durations[key] != nil:
+			*durations[key], err = time.ParseDuration(value)
+		default:
+			keys := make([]string, 0, len(rates)+len(durations)+1)
+			keys = append(keys, "seed")
+			for k := range rates {
+				keys = append(keys, k)
+			}
+			for k := range durations {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return cfg, fmt.Errorf("chaos: unknown key %q, want one of %s", key, strings.Join(keys, ", "))
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("chaos: %s: %w", key, err)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,181 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chaosRange is 5000 minutes of settled simulated history, six blocks.
+const chaosStart, chaosEnd = int64(1717200000), int64(1717200000 + 5000*60)
+
+func chaosServices(config ChaosConfig) (clean, chaotic *Service) {
+	sim := NewSimulatedProvider(42)
+	clean = NewService(map[string]ExchangeProvider{"simulated": sim})
+	chaotic = NewService(map[string]ExchangeProvider{"simulated": NewChaosProvider(sim, config)})
+	return clean, chaotic
+}
+
+func TestChaosResponsesAreCleanedUp(t *testing.T) {
+	clean, chaotic := chaosServices(ChaosConfig{Seed: 1, DuplicateRate: 1, ShuffleRate: 1})
+	ctx := context.Background()
+
+	want, err := clean.FetchCandles(ctx, "simulated", "SIM-BTC", chaosStart, chaosEnd, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := chaotic.FetchCandles(ctx, "simulated", "SIM-BTC", chaosStart, chaosEnd, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candle %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestChaosResponsesAreNotKept(t *testing.T) {
+	_, chaotic := chaosServices(ChaosConfig{Seed: 1, TruncateRate: 1})
+	ctx := context.Background()
+
+	if _, err := chaotic.FetchCandles(ctx, "simulated", "SIM-BTC", chaosStart, chaosEnd, 60); err != nil {
+		t.Fatal(err)
+	}
+	// A truncated block must not be served again once chaos is turned off
+	_, blocks, _ := chaotic.plan("simulated", chaosStart, chaosEnd, 60)
+	for _, b := range blocks {
+		if cached := chaotic.GetFromCache(ctx, "SIM-BTC", "simulated", b.Start, 60); len(cached) > 0 {
+			t.Errorf("block %d was cached", b.Start)
+		}
+	}
+}
+
+func TestChaosListingsDontHang(t *testing.T) {
+	chaos := NewChaosProvider(NewSimulatedProvider(42), ChaosConfig{HangRate: 1})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := chaos.GetProducts()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got %v, want the listing", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listing hung")
+	}
+}
+
+func TestChaosFailuresBecomeGaps(t *testing.T) {
+	clean, chaotic := chaosServices(ChaosConfig{Seed: 2, ErrorRate: 0.6, RateLimitRate: 0.2, RetryAfter: time.Millisecond})
+	ctx := context.Background()
+	tf := Timeframes["1m"]
+
+	want, err := clean.FetchTimeframe(ctx, "simulated", "SIM-ETH", chaosStart, chaosEnd, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := chaotic.FetchTimeframePartial(ctx, "simulated", "SIM-ETH", chaosStart, chaosEnd, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed int
+	for _, g := range result.Gaps {
+		if g.Kind != GapFetchFailed {
+			t.Errorf("unexpected %s gap %d-%d", g.Kind, g.Start, g.End)
+		}
+		failed++
+	}
+	if failed == 0 || len(result.Candles) == 0 {
+		t.Fatalf("want a mix of candles and failures, got %d candles and %d gaps", len(result.Candles), failed)
+	}
+
+	got := make(map[int64]Candlestick, len(result.Candles))
+	for _, c := range result.Candles {
+		got[c.Timestamp] = c
+	}
+	for _, c := range want {
+		if have, ok := got[c.Timestamp]; ok {
+			if have != c {
+				t.Errorf("candle at %d = %+v, want %+v", c.Timestamp, have, c)
+			}
+			continue
+		}
+
+		covered := false
+		for _, g := range result.Gaps {
+			covered = covered || (c.Timestamp >= g.Start && c.Timestamp <= g.End)
+		}
+		if !covered {
+			t.Errorf("candle at %d is missing without a gap", c.Timestamp)
+		}
+	}
+}
+
+func TestChaosHangIsBoundedByDeadline(t *testing.T) {
+	_, chaotic := chaosServices(ChaosConfig{HangRate: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	began := time.Now()
+	_, err := chaotic.FetchCandles(ctx, "simulated", "SIM-BTC", chaosStart, chaosEnd, 60)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(began); elapsed > time.Second {
+		t.Errorf("took %v to give up", elapsed)
+	}
+}
+
+func TestChaosHangingBlocksBecomeGaps(t *testing.T) {
+	_, chaotic := chaosServices(ChaosConfig{Seed: 3, HangRate: 0.5})
+	chaotic.BlockTimeout = 2 * time.Second
+
+	began := time.Now()
+	result, err := chaotic.FetchTimeframePartial(context.Background(), "simulated", "SIM-BTC", chaosStart, chaosEnd, Timeframes["1m"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(began); elapsed > 10*time.Second {
+		t.Errorf("took %v to give up on the hanging blocks", elapsed)
+	}
+
+	var timedOut int
+	for _, g := range result.Gaps {
+		if g.Kind == GapFetchFailed {
+			if !strings.Contains(g.Reason, "timed out") {
+				t.Errorf("gap %d-%d reason %q, want a timeout", g.Start, g.End, g.Reason)
+			}
+			timedOut++
+		}
+	}
+	if timedOut == 0 || len(result.Candles) == 0 {
+		t.Fatalf("want a mix of candles and timed out blocks, got %d candles and %d failed gaps", len(result.Candles), timedOut)
+	}
+}
+
+func TestParseChaosConfig(t *testing.T) {
+	cfg, err := ParseChaosConfig("seed=7, latency=200ms, error=0.1, 429=0.05, retryafter=2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChaosConfig{Seed: 7, Latency: 200 * time.Millisecond, ErrorRate: 0.1, RateLimitRate: 0.05, RetryAfter: 2 * time.Second}
+	if cfg != want {
+		t.Errorf("got %+v, want %+v", cfg, want)
+	}
+
+	if _, err := ParseChaosConfig("flaky=1"); err == nil {
+		t.Error("unknown key accepted")
+	}
+}
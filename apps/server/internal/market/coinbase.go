@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"sort"
 )
@@ -12,42 +12,74 @@ import (
 type CoinbaseProvider struct {
 	Client  *http.Client
 	BaseURL string
+	WSURL   string
 }
 
 func (c *CoinbaseProvider) ID() string {
 	return "coinbase"
 }
 
+func (c *CoinbaseProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Granularities:        []int64{60, 300, 900, 3600, 21600, 86400},
+		MaxCandlesPerRequest: 300,
+		// The exchange opened to the public in January 2015
+		HistoryStart: 1420070400,
+		AssetTypes:   []string{"crypto"},
+	}
+}
+
+// RateLimit follows Coinbase's public endpoint budget of 10 requests per
+// second with bursts of up to 15.
+func (c *CoinbaseProvider) RateLimit() RateLimit {
+	return RateLimit{Rate: 10, Burst: 15}
+}
+
 type coinbaseProduct struct {
-	ID            string `json:"id"`
-	QuoteCurrency string `json:"quote_currency"`
-	BaseCurrency  string `json:"base_currency"`
-	DisplayName   string `json:"display_name"`
-	Status        string `json:"status"`
+	ID              string `json:"id"`
+	QuoteCurrency   string `json:"quote_currency"`
+	BaseCurrency    string `json:"base_currency"`
+	DisplayName     string `json:"display_name"`
+	Status          string `json:"status"`
+	QuoteIncrement  string `json:"quote_increment"`
+	BaseIncrement   string `json:"base_increment"`
+	BaseMinSize     string `json:"base_min_size"`
+	TradingDisabled bool   `json:"trading_disabled"`
+	CancelOnly      bool   `json:"cancel_only"`
+	LimitOnly       bool   `json:"limit_only"`
+	PostOnly        bool   `json:"post_only"`
+	MarginEnabled   bool   `json:"margin_enabled"`
 }
 
-func (c *CoinbaseProvider) GetProducts() ([]Product, error) {
-	url := fmt.Sprintf("%s/products", c.BaseURL)
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
-	if err != nil {
-		return nil, err
+func (p coinbaseProduct) status() string {
+	switch {
+	case p.TradingDisabled || p.CancelOnly:
+		return StatusHalted
+	case p.LimitOnly || p.PostOnly:
+		return StatusLimited
 	}
+	return StatusOnline
+}
 
-	req.Header.Set("User-Agent", "Cochart-App")
+// coinbaseStats is a product's entry in /products/stats. Volume is in the
+// base currency.
+type coinbaseStats struct {
+	Stats24Hour struct {
+		Last   string `json:"last"`
+		Volume string `json:"volume"`
+	} `json:"stats_24hour"`
+}
 
-	res, err := c.Client.Do(req)
-	if err != nil {
+func (c *CoinbaseProvider) GetProducts() ([]Product, error) {
+	var raw []coinbaseProduct
+	if err := c.get(context.Background(), "/products", &raw); err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("coinbase status: %d", res.StatusCode)
-	}
 
-	var raw []coinbaseProduct
-	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
-		return nil, fmt.Errorf("parse error: %v", err)
+	// Volume only ranks search results, a listing without it is still good
+	var stats map[string]coinbaseStats
+	if err := c.get(context.Background(), "/products/stats", &stats); err != nil {
+		log.Printf("Coinbase product stats: %v", err)
 	}
 
 	products := make([]Product, 0, len(raw))
@@ -61,12 +93,47 @@ func (c *CoinbaseProvider) GetProducts() ([]Product, error) {
 			Name:     p.BaseCurrency + p.QuoteCurrency,
 			Type:     "crypto",
 			Exchange: "coinbase",
+			Base:     p.BaseCurrency,
+			Quote:    p.QuoteCurrency,
+
+			PriceIncrement: parseIncrement(p.QuoteIncrement),
+			SizeIncrement:  parseIncrement(p.BaseIncrement),
+			MinSize:        parseIncrement(p.BaseMinSize),
+			PricePrecision: decimalsOf(p.QuoteIncrement),
+			SizePrecision:  decimalsOf(p.BaseIncrement),
+			Status:         p.status(),
+			Spot:           true,
+			Margin:         p.MarginEnabled,
+			Volume24h:      parseFloat(stats[p.ID].Stats24Hour.Volume) * parseFloat(stats[p.ID].Stats24Hour.Last),
 		})
 	}
 
 	return products, nil
 }
 
+// get decodes the JSON answer to a GET of path.
+func (c *CoinbaseProvider) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Cochart-App")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return requestError("coinbase", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errorFromResponse("coinbase", res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return parseError("coinbase", err)
+	}
+	return nil
+}
+
 func (c *CoinbaseProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
 	// API Docs: /products/{product_id}/candles
 	url := fmt.Sprintf("%s/products/%s/candles?granularity=%d&start=%d&end=%d",
@@ -81,20 +148,19 @@ func (c *CoinbaseProvider) FetchCandles(ctx context.Context, symbol string, star
 
 	res, err := c.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, requestError("coinbase", err)
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		return nil, fmt.Errorf("coinbase error %d: %s", res.StatusCode, string(body))
+		return nil, errorFromResponse("coinbase", res)
 	}
 
 	// Parse Response (Coinbase returns array of arrays)
 	// [ [ time, low, high, open, close, volume ], ... ]
 	var raw [][]float64
 	if err := json.NewDecoder(res.Body).Decode(&raw); err != nil {
-		return nil, fmt.Errorf("parse error: %v", err)
+		return nil, parseError("coinbase", err)
 	}
 
 	candles := make([]Candlestick, 0, len(raw))
@@ -0,0 +1,137 @@
+package market
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type coinbaseStream struct {
+	conn  *websocket.Conn
+	mu    sync.Mutex
+	ticks chan Tick
+}
+
+type coinbaseSubscription struct {
+	Type       string   `json:"type"`
+	ProductIDs []string `json:"product_ids"`
+	Channels   []string `json:"channels"`
+}
+
+// coinbaseTicker is a message of the ticker or matches channel. Ticker
+// messages are throttled and may stand for several trades, so traded size
+// is only taken from matches, which arrive once per trade.
+type coinbaseTicker struct {
+	Type      string `json:"type"`
+	ProductID string `json:"product_id"`
+	Price     string `json:"price"`
+	Size      string `json:"size"`
+	Volume24h string `json:"volume_24h"`
+	BestBid   string `json:"best_bid"`
+	BestAsk   string `json:"best_ask"`
+	Time      string `json:"time"`
+}
+
+func (c *CoinbaseProvider) OpenTickStream(ctx context.Context) (TickStream, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, c.WSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &coinbaseStream{conn: conn, ticks: make(chan Tick, 256)}
+	go s.read()
+	return s, nil
+}
+
+func (s *coinbaseStream) Subscribe(symbols ...string) error {
+	return s.send("subscribe", symbols)
+}
+
+func (s *coinbaseStream) Unsubscribe(symbols ...string) error {
+	return s.send("unsubscribe", symbols)
+}
+
+func (s *coinbaseStream) send(kind string, symbols []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return s.conn.WriteJSON(coinbaseSubscription{
+		Type:       kind,
+		ProductIDs: symbols,
+		Channels:   []string{"ticker", "matches"},
+	})
+}
+
+func (s *coinbaseStream) Ticks() <-chan Tick {
+	return s.ticks
+}
+
+func (s *coinbaseStream) Close() error {
+	return s.conn.Close()
+}
+
+// coinbaseQuote is the latest ticker message for a product, carried along
+// on the ticks its trades make.
+type coinbaseQuote struct {
+	bid, ask, volume float64
+	traded           bool
+}
+
+// read turns trades into ticks, one per match. Ticker messages only refresh
+// the quote riding along with them, except before a product's first trade,
+// when they stand in so a quiet market still shows a price.
+func (s *coinbaseStream) read() {
+	defer close(s.ticks)
+
+	quotes := make(map[string]*coinbaseQuote)
+	for {
+		var msg coinbaseTicker
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.ProductID == "" || msg.Price == "" {
+			continue
+		}
+
+		q, ok := quotes[msg.ProductID]
+		if !ok {
+			q = &coinbaseQuote{}
+			quotes[msg.ProductID] = q
+		}
+
+		tick := Tick{
+			Exchange:  "coinbase",
+			Symbol:    msg.ProductID,
+			Price:     parseFloat(msg.Price),
+			Timestamp: time.Now().Unix(),
+		}
+		switch msg.Type {
+		case "ticker":
+			q.bid, q.ask, q.volume = parseFloat(msg.BestBid), parseFloat(msg.BestAsk), parseFloat(msg.Volume24h)
+			if q.traded {
+				continue
+			}
+		case "match":
+			tick.Size = parseFloat(msg.Size)
+			q.traded = true
+		default:
+			// last_match repeats a trade from before subscribing
+			continue
+		}
+		tick.Bid, tick.Ask, tick.Volume = q.bid, q.ask, q.volume
+		if t, err := time.Parse(time.RFC3339Nano, msg.Time); err == nil {
+			tick.Timestamp = t.Unix()
+		}
+
+		s.ticks <- tick
+	}
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
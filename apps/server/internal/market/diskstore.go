@@ -0,0 +1,439 @@
+package market
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DiskStore persists closed candle blocks so they survive restarts. Each
+// provider/symbol/granularity series is an append-only log of blocks:
+//
+//	header: magic uint32 | block start int64 | count uint32
+//	record: time int64 | open | high | low | close | volume float64
+//
+// A block written twice is superseded by the later copy until Compact
+// rewrites the file. When the store grows past MaxBytes the least recently
+// used series are dropped.
+//
+// Each series has its own lock, so reads and writes of different series
+// don't wait on each other. d.mu only guards the series map and is always
+// taken after a series lock, never before.
+type DiskStore struct {
+	Dir      string
+	MaxBytes int64
+
+	mu     sync.Mutex
+	series map[string]*storedSeries
+	total  atomic.Int64
+}
+
+type storedSeries struct {
+	path string
+	// Unix nanoseconds, read without mu when picking series to evict
+	lastUsed atomic.Int64
+
+	// mu guards the file and the fields below
+	mu      sync.Mutex
+	blocks  map[int64]storedBlock
+	size    int64
+	live    int64
+	evicted bool
+}
+
+type storedBlock struct {
+	offset int64
+	count  int
+}
+
+const (
+	storeMagic      = 0x43434231 // "CCB1"
+	storeHeaderSize = 16
+	storeRecordSize = 48
+	storeExt        = ".candles"
+)
+
+func OpenDiskStore(dir string, maxBytes int64) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	d := &DiskStore{Dir: dir, MaxBytes: maxBytes, series: make(map[string]*storedSeries)}
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != storeExt {
+			return err
+		}
+		s, err := loadSeries(path)
+		if err != nil {
+			log.Printf("Skipping candle store file %s: %v", path, err)
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			s.lastUsed.Store(info.ModTime().UnixNano())
+		}
+		d.series[path] = s
+		d.total.Add(s.size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *DiskStore) seriesPath(exchange, symbol string, granularity int64) string {
+	return filepath.Join(d.Dir, pathSegment(exchange), pathSegment(symbol), strconv.FormatInt(granularity, 10)+storeExt)
+}
+
+// pathSegment escapes a name into a single directory name. PathEscape leaves
+// dots alone, so a name of only dots has them escaped too rather than
+// pointing at the store directory or its parent.
+func pathSegment(name string) string {
+	escaped := url.PathEscape(name)
+	if strings.Trim(escaped, ".") == "" {
+		return strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return escaped
+}
+
+// loadSeries indexes a series file, truncating a torn write at its tail.
+func loadSeries(path string) (*storedSeries, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &storedSeries{path: path, blocks: make(map[int64]storedBlock)}
+	header := make([]byte, storeHeaderSize)
+	var offset int64
+	for offset+storeHeaderSize <= info.Size() {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			return nil, err
+		}
+		if binary.LittleEndian.Uint32(header[0:]) != storeMagic {
+			break
+		}
+
+		start := int64(binary.LittleEndian.Uint64(header[4:]))
+		count := int(binary.LittleEndian.Uint32(header[12:]))
+		length := int64(storeHeaderSize + count*storeRecordSize)
+		if offset+length > info.Size() {
+			break
+		}
+
+		if old, ok := s.blocks[start]; ok {
+			s.live -= int64(storeHeaderSize + old.count*storeRecordSize)
+		}
+		s.blocks[start] = storedBlock{offset: offset, count: count}
+		s.live += length
+		offset += length
+	}
+
+	if offset < info.Size() {
+		if err := f.Truncate(offset); err != nil {
+			return nil, err
+		}
+	}
+	s.size = offset
+
+	return s, nil
+}
+
+// lock returns the series for a path with its lock held, creating it if
+// asked to. A series evicted while we waited is replaced by a fresh one.
+func (d *DiskStore) lock(path string, create bool) *storedSeries {
+	for {
+		d.mu.Lock()
+		s, ok := d.series[path]
+		if !ok && create {
+			s = &storedSeries{path: path, blocks: make(map[int64]storedBlock)}
+			d.series[path] = s
+		}
+		d.mu.Unlock()
+		if s == nil {
+			return nil
+		}
+
+		s.mu.Lock()
+		if !s.evicted {
+			return s
+		}
+		s.mu.Unlock()
+		if !create {
+			return nil
+		}
+	}
+}
+
+// Load returns a stored block, or false if the store has never seen it.
+func (d *DiskStore) Load(exchange, symbol string, granularity, start int64) ([]Candlestick, bool) {
+	s := d.lock(d.seriesPath(exchange, symbol, granularity), false)
+	if s == nil {
+		return nil, false
+	}
+	defer s.mu.Unlock()
+
+	block, ok := s.blocks[start]
+	if !ok {
+		return nil, false
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	data := make([]byte, block.count*storeRecordSize)
+	if _, err := f.ReadAt(data, block.offset+storeHeaderSize); err != nil {
+		return nil, false
+	}
+
+	candles := make([]Candlestick, block.count)
+	for i := range candles {
+		candles[i] = decodeCandle(data[i*storeRecordSize:])
+	}
+
+	s.lastUsed.Store(time.Now().UnixNano())
+	return candles, true
+}
+
+// Save appends a closed block to its series.
+func (d *DiskStore) Save(exchange, symbol string, granularity, start int64, candles []Candlestick) error {
+	path := d.seriesPath(exchange, symbol, granularity)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	s := d.lock(path, true)
+	if err := d.appendBlock(s, start, candles); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	d.enforceBudget(s)
+	return nil
+}
+
+// appendBlock writes a block to the end of a series. Must be called with
+// s.mu held.
+func (d *DiskStore) appendBlock(s *storedSeries, start int64, candles []Candlestick) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data := encodeBlock(start, candles)
+	if _, err := f.Write(data); err != nil {
+		// Drop whatever made it to disk so the log stays well formed
+		f.Truncate(s.size)
+		return err
+	}
+
+	length := int64(len(data))
+	if old, ok := s.blocks[start]; ok {
+		s.live -= int64(storeHeaderSize + old.count*storeRecordSize)
+	}
+	s.blocks[start] = storedBlock{offset: s.size, count: len(candles)}
+	s.size += length
+	s.live += length
+	s.lastUsed.Store(time.Now().UnixNano())
+	d.total.Add(length)
+	return nil
+}
+
+// enforceBudget removes least recently used series, never the one just
+// written, until the store fits MaxBytes.
+func (d *DiskStore) enforceBudget(keep *storedSeries) {
+	if d.MaxBytes <= 0 || d.total.Load() <= d.MaxBytes {
+		return
+	}
+
+	victims := d.snapshot()
+	victims = slices.DeleteFunc(victims, func(s *storedSeries) bool { return s == keep })
+	sort.Slice(victims, func(i, j int) bool {
+		return victims[i].lastUsed.Load() < victims[j].lastUsed.Load()
+	})
+
+	for _, s := range victims {
+		if d.total.Load() <= d.MaxBytes {
+			return
+		}
+		s.mu.Lock()
+		if !s.evicted {
+			d.evict(s)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// evict removes a series from disk and from the store. Must be called with
+// s.mu held.
+func (d *DiskStore) evict(s *storedSeries) {
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Evicting %s: %v", s.path, err)
+		return
+	}
+	s.evicted = true
+	d.total.Add(-s.size)
+
+	d.mu.Lock()
+	if d.series[s.path] == s {
+		delete(d.series, s.path)
+	}
+	d.mu.Unlock()
+}
+
+// snapshot lists the series currently in the store.
+func (d *DiskStore) snapshot() []*storedSeries {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	series := make([]*storedSeries, 0, len(d.series))
+	for _, s := range d.series {
+		series = append(series, s)
+	}
+	return series
+}
+
+// Compact rewrites series files that carry superseded blocks so that only
+// the latest copy of each block remains, ordered by time.
+func (d *DiskStore) Compact() error {
+	var errs []error
+	for _, s := range d.snapshot() {
+		s.mu.Lock()
+		if !s.evicted && s.live != s.size {
+			if err := d.compactSeries(s); err != nil {
+				errs = append(errs, fmt.Errorf("compact %s: %w", s.path, err))
+			}
+		}
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// compactSeries must be called with s.mu held.
+func (d *DiskStore) compactSeries(s *storedSeries) error {
+	src, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := s.path + ".tmp"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	starts := make([]int64, 0, len(s.blocks))
+	for start := range s.blocks {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	blocks := make(map[int64]storedBlock, len(starts))
+	var offset int64
+	for _, start := range starts {
+		block := s.blocks[start]
+		length := int64(storeHeaderSize + block.count*storeRecordSize)
+		if _, err := io.Copy(dst, io.NewSectionReader(src, block.offset, length)); err != nil {
+			dst.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		blocks[start] = storedBlock{offset: offset, count: block.count}
+		offset += length
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	d.total.Add(offset - s.size)
+	s.blocks = blocks
+	s.size = offset
+	s.live = offset
+	return nil
+}
+
+func (d *DiskStore) StartCompactor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := d.Compact(); err != nil {
+					log.Printf("Candle store compaction: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Size reports how many bytes the store currently occupies on disk.
+func (d *DiskStore) Size() int64 {
+	return d.total.Load()
+}
+
+func encodeBlock(start int64, candles []Candlestick) []byte {
+	data := make([]byte, storeHeaderSize+len(candles)*storeRecordSize)
+	binary.LittleEndian.PutUint32(data[0:], storeMagic)
+	binary.LittleEndian.PutUint64(data[4:], uint64(start))
+	binary.LittleEndian.PutUint32(data[12:], uint32(len(candles)))
+
+	for i, c := range candles {
+		r := data[storeHeaderSize+i*storeRecordSize:]
+		binary.LittleEndian.PutUint64(r[0:], uint64(c.Timestamp))
+		binary.LittleEndian.PutUint64(r[8:], math.Float64bits(c.Open))
+		binary.LittleEndian.PutUint64(r[16:], math.Float64bits(c.High))
+		binary.LittleEndian.PutUint64(r[24:], math.Float64bits(c.Low))
+		binary.LittleEndian.PutUint64(r[32:], math.Float64bits(c.Close))
+		binary.LittleEndian.PutUint64(r[40:], math.Float64bits(c.Volume))
+	}
+	return data
+}
+
+func decodeCandle(r []byte) Candlestick {
+	return Candlestick{
+		Timestamp: int64(binary.LittleEndian.Uint64(r[0:])),
+		Open:      math.Float64frombits(binary.LittleEndian.Uint64(r[8:])),
+		High:      math.Float64frombits(binary.LittleEndian.Uint64(r[16:])),
+		Low:       math.Float64frombits(binary.LittleEndian.Uint64(r[24:])),
+		Close:     math.Float64frombits(binary.LittleEndian.Uint64(r[32:])),
+		Volume:    math.Float64frombits(binary.LittleEndian.Uint64(r[40:])),
+	}
+}
@@ -0,0 +1,305 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func storeBlock(start int64, n int, price float64) []Candlestick {
+	candles := make([]Candlestick, n)
+	for i := range candles {
+		candles[i] = Candlestick{Timestamp: start + int64(i)*60, Open: price, High: price + 1, Low: price - 1, Close: price + 0.5, Volume: float64(i)}
+	}
+	return candles
+}
+
+func assertBlock(t *testing.T, d *DiskStore, exchange, symbol string, start int64, want []Candlestick) {
+	t.Helper()
+	got, ok := d.Load(exchange, symbol, 60, start)
+	if !ok {
+		t.Fatalf("block %s %s %d not found", exchange, symbol, start)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("block %d has %d candles, want %d", start, len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candle %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiskStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := storeBlock(0, 300, 100), storeBlock(18000, 120, 200)
+	if err := d.Save("coinbase", "BTC-USD", 60, 0, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Save("coinbase", "BTC-USD", 60, 18000, second); err != nil {
+		t.Fatal(err)
+	}
+	// Odd symbols must still make a single file name
+	if err := d.Save("kraken", "XBT/USD", 60, 0, first); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []*DiskStore{d, reopened} {
+		assertBlock(t, store, "coinbase", "BTC-USD", 0, first)
+		assertBlock(t, store, "coinbase", "BTC-USD", 18000, second)
+		assertBlock(t, store, "kraken", "XBT/USD", 0, first)
+		if _, ok := store.Load("coinbase", "BTC-USD", 60, 36000); ok {
+			t.Error("found a block never saved")
+		}
+	}
+	if reopened.Size() != d.Size() {
+		t.Errorf("reopened store is %d bytes, want %d", reopened.Size(), d.Size())
+	}
+}
+
+func TestDiskStoreTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := storeBlock(0, 10, 100)
+	if err := d.Save("coinbase", "BTC-USD", 60, 0, good); err != nil {
+		t.Fatal(err)
+	}
+	path := d.seriesPath("coinbase", "BTC-USD", 60)
+	intact := d.Size()
+
+	// A crash halfway through appending the next block
+	torn := encodeBlock(18000, storeBlock(18000, 10, 200))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(torn[:len(torn)/2])
+	f.Close()
+
+	reopened, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBlock(t, reopened, "coinbase", "BTC-USD", 0, good)
+	if _, ok := reopened.Load("coinbase", "BTC-USD", 60, 18000); ok {
+		t.Error("torn block was loaded")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != intact {
+		t.Fatalf("file not truncated back to %d bytes: %v %v", intact, info.Size(), err)
+	}
+
+	// Appends carry on from the last whole block
+	next := storeBlock(18000, 10, 300)
+	if err := reopened.Save("coinbase", "BTC-USD", 60, 18000, next); err != nil {
+		t.Fatal(err)
+	}
+	again, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBlock(t, again, "coinbase", "BTC-USD", 0, good)
+	assertBlock(t, again, "coinbase", "BTC-USD", 18000, next)
+}
+
+func TestDiskStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	blockSize := int64(len(encodeBlock(0, storeBlock(0, 10, 1))))
+	d, err := OpenDiskStore(t.TempDir(), 2*blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Save("coinbase", "OLD-USD", 60, 0, storeBlock(0, 10, 1))
+	d.Save("coinbase", "USED-USD", 60, 0, storeBlock(0, 10, 2))
+	// Reading OLD-USD makes USED-USD the least recently used
+	if _, ok := d.Load("coinbase", "OLD-USD", 60, 0); !ok {
+		t.Fatal("block missing before the budget was reached")
+	}
+
+	if err := d.Save("coinbase", "NEW-USD", 60, 0, storeBlock(0, 10, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if d.Size() > 2*blockSize {
+		t.Errorf("store is %d bytes, over its %d byte budget", d.Size(), 2*blockSize)
+	}
+	if _, ok := d.Load("coinbase", "USED-USD", 60, 0); ok {
+		t.Error("least recently used series survived")
+	}
+	for _, symbol := range []string{"OLD-USD", "NEW-USD"} {
+		if _, ok := d.Load("coinbase", symbol, 60, 0); !ok {
+			t.Errorf("%s was evicted", symbol)
+		}
+	}
+	if _, err := os.Stat(d.seriesPath("coinbase", "USED-USD", 60)); !os.IsNotExist(err) {
+		t.Errorf("evicted file still on disk: %v", err)
+	}
+
+	// The series being written is kept even when it alone is over budget
+	big := storeBlock(0, 100, 4)
+	if err := d.Save("coinbase", "BIG-USD", 60, 0, big); err != nil {
+		t.Fatal(err)
+	}
+	assertBlock(t, d, "coinbase", "BIG-USD", 0, big)
+}
+
+func TestDiskStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := storeBlock(0, 10, 3)
+	other := storeBlock(18000, 10, 9)
+	d.Save("coinbase", "BTC-USD", 60, 18000, other)
+	d.Save("coinbase", "BTC-USD", 60, 0, storeBlock(0, 10, 1))
+	d.Save("coinbase", "BTC-USD", 60, 0, storeBlock(0, 12, 2))
+	d.Save("coinbase", "BTC-USD", 60, 0, latest)
+	before := d.Size()
+
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	want := int64(len(encodeBlock(0, latest)) + len(encodeBlock(18000, other)))
+	if d.Size() != want || d.Size() >= before {
+		t.Errorf("compacted to %d bytes from %d, want %d", d.Size(), before, want)
+	}
+	if info, err := os.Stat(d.seriesPath("coinbase", "BTC-USD", 60)); err != nil || info.Size() != want {
+		t.Errorf("file is %v bytes after compaction, want %d", info.Size(), want)
+	}
+	assertBlock(t, d, "coinbase", "BTC-USD", 0, latest)
+	assertBlock(t, d, "coinbase", "BTC-USD", 18000, other)
+
+	reopened, err := OpenDiskStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBlock(t, reopened, "coinbase", "BTC-USD", 0, latest)
+	assertBlock(t, reopened, "coinbase", "BTC-USD", 18000, other)
+	if reopened.Size() != want {
+		t.Errorf("reopened compacted store is %d bytes, want %d", reopened.Size(), want)
+	}
+}
+
+func TestDiskStoreKeepsDotNamesInside(t *testing.T) {
+	dir := t.TempDir()
+	d, err := OpenDiskStore(filepath.Join(dir, "store"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{".", "..", "...", "%2E", "a..b"}
+	for i, name := range names {
+		path := d.seriesPath(name, name, 60)
+		if rel, err := filepath.Rel(d.Dir, path); err != nil || strings.HasPrefix(rel, "..") || strings.Count(rel, string(filepath.Separator)) != 2 {
+			t.Errorf("%q is stored at %s, outside its own directories", name, path)
+		}
+		if err := d.Save(name, name, 60, 0, storeBlock(0, 5, float64(i))); err != nil {
+			t.Fatalf("saving %q: %v", name, err)
+		}
+	}
+
+	reopened, err := OpenDiskStore(d.Dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		assertBlock(t, reopened, name, name, 0, storeBlock(0, 5, float64(i)))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("store wrote %d entries next to its directory", len(entries)-1)
+	}
+}
+
+func TestDiskStoreLocksPerSeries(t *testing.T) {
+	d, err := OpenDiskStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Save("coinbase", "BTC-USD", 60, 0, storeBlock(0, 10, 1))
+
+	// A slow reader of one series holds only that series
+	busy := d.lock(d.seriesPath("coinbase", "BTC-USD", 60), false)
+	done := make(chan error, 1)
+	go func() {
+		if err := d.Save("coinbase", "ETH-USD", 60, 0, storeBlock(0, 10, 2)); err != nil {
+			done <- err
+			return
+		}
+		if _, ok := d.Load("coinbase", "ETH-USD", 60, 0); !ok {
+			done <- errors.New("ETH-USD block not found")
+			return
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("another series waited on a busy one")
+	}
+	busy.mu.Unlock()
+}
+
+func TestDiskStoreConcurrentSaves(t *testing.T) {
+	blockSize := int64(len(encodeBlock(0, storeBlock(0, 10, 1))))
+	d, err := OpenDiskStore(t.TempDir(), 6*blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				symbol := fmt.Sprintf("S%d-USD", (g+i)%4)
+				start := int64(i%3) * 18000
+				if err := d.Save("coinbase", symbol, 60, start, storeBlock(start, 10, float64(i))); err != nil {
+					t.Error(err)
+					return
+				}
+				d.Load("coinbase", symbol, 60, start)
+				if i%10 == 0 {
+					if err := d.Compact(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// What the store counts is what is on disk
+	var onDisk int64
+	filepath.WalkDir(d.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			info, _ := entry.Info()
+			onDisk += info.Size()
+		}
+		return err
+	})
+	if onDisk != d.Size() {
+		t.Errorf("store counts %d bytes, %d on disk", d.Size(), onDisk)
+	}
+}
@@ -0,0 +1,127 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Provider error kinds. Match them with errors.Is.
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrNotFound    = errors.New("not found")
+	ErrBadRequest  = errors.New("bad request")
+	ErrTransient   = errors.New("transient failure")
+	// ErrCircuitOpen means calls to the provider are being refused until it
+	// has had time to recover
+	ErrCircuitOpen = errors.New("circuit open")
+)
+
+type ProviderError struct {
+	Provider   string
+	Kind       error
+	StatusCode int
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Provider, e.Kind)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (%d)", e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Kind
+}
+
+// errorFromResponse classifies a non-2xx upstream response.
+func errorFromResponse(provider string, res *http.Response) *ProviderError {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	e := &ProviderError{
+		Provider:   provider,
+		StatusCode: res.StatusCode,
+		Message:    string(body),
+	}
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+		e.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	case res.StatusCode == http.StatusNotFound:
+		e.Kind = ErrNotFound
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		e.Kind = ErrBadRequest
+	default:
+		e.Kind = ErrTransient
+	}
+	return e
+}
+
+// requestError classifies a request that got no response. Network trouble
+// is transient; the caller giving up is passed through as it is.
+func requestError(provider string, err error) error {
+	var nerr net.Error
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &nerr) {
+		return err
+	}
+	return &ProviderError{Provider: provider, Kind: ErrTransient, Message: err.Error()}
+}
+
+// parseError classifies a response that couldn't be read or understood,
+// most likely a body cut short or garbled on the way, as transient.
+func parseError(provider string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &ProviderError{Provider: provider, Kind: ErrTransient, Message: "parse error: " + err.Error()}
+}
+
+// parseRetryAfter reads a Retry-After header in either delta-seconds or
+// HTTP-date form.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// IsRetryable reports whether trying the same request again could succeed.
+// Errors that aren't typed are assumed to be network trouble.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrBadRequest), errors.Is(err, ErrCircuitOpen):
+		return false
+	}
+	return true
+}
+
+// retryDelay honours Retry-After when upstream sent one and otherwise backs
+// off exponentially.
+func retryDelay(err error, attempt int, jitter time.Duration) time.Duration {
+	var perr *ProviderError
+	if errors.As(err, &perr) && perr.RetryAfter > 0 {
+		return perr.RetryAfter
+	}
+	return time.Duration(200*(1<<attempt))*time.Millisecond + jitter
+}
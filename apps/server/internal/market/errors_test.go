@@ -0,0 +1,121 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNetworkAndParseErrorsAreTransient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/garbled/products/BTC-USD/candles":
+			w.Write([]byte(`[[1717200000, 1, 2`))
+		case "/hangup/products/BTC-USD/candles":
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/garbled", "/hangup"} {
+		provider := &CoinbaseProvider{Client: server.Client(), BaseURL: server.URL + path}
+		_, err := provider.FetchCandles(context.Background(), "BTC-USD", 1717200000, 1717203600, 60)
+		if !errors.Is(err, ErrTransient) || !IsRetryable(err) {
+			t.Errorf("%s: got %v, want a transient error", path, err)
+		}
+	}
+
+	// Giving up is the caller's doing, not the provider's
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	provider := &CoinbaseProvider{Client: server.Client(), BaseURL: server.URL + "/garbled"}
+	if _, err := provider.FetchCandles(ctx, "BTC-USD", 1717200000, 1717203600, 60); !errors.Is(err, context.Canceled) || errors.Is(err, ErrTransient) {
+		t.Errorf("cancelled: got %v, want context.Canceled", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"0", 0},
+		{"-5", 0},
+		{"Sat, 01 Jun 2024 12:00:30 GMT", 30 * time.Second},
+		{"Sat, 01 Jun 2024 11:59:00 GMT", 0},
+		{"soon", 0},
+	} {
+		if got := parseRetryAfter(tc.header, now); got != tc.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
+
+// scriptedProvider answers candle requests with errs in turn, then
+// succeeds, noting when each attempt came.
+type scriptedProvider struct {
+	gatedProvider
+	errs []error
+
+	mu       sync.Mutex
+	attempts []time.Time
+}
+
+func (p *scriptedProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.attempts = append(p.attempts, time.Now())
+	if n := len(p.attempts); n <= len(p.errs) {
+		return nil, p.errs[n-1]
+	}
+	return []Candlestick{{Timestamp: start, Open: 1, High: 1, Low: 1, Close: 1}}, nil
+}
+
+func TestRateLimitedRetryHonoursRetryAfter(t *testing.T) {
+	provider := &scriptedProvider{errs: []error{
+		&ProviderError{Provider: "gated", Kind: ErrRateLimited, StatusCode: 429, RetryAfter: 150 * time.Millisecond},
+	}}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+
+	if _, err := service.FetchCandles(context.Background(), "gated", "X", 0, 60*299, 60); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.attempts) != 2 {
+		t.Fatalf("got %d attempts, want 2", len(provider.attempts))
+	}
+	if gap := provider.attempts[1].Sub(provider.attempts[0]); gap < 150*time.Millisecond {
+		t.Errorf("retried after %v, want the 150ms upstream asked for", gap)
+	}
+
+	// Every caller of the provider is held back, not just the one that
+	// was told
+	limiter := service.limiters["gated"]
+	limiter.mu.Lock()
+	paused := limiter.paused
+	limiter.mu.Unlock()
+	if want := provider.attempts[0].Add(140 * time.Millisecond); paused.Before(want) {
+		t.Errorf("limiter paused until %v, want at least %v", paused, want)
+	}
+}
+
+func TestRequestErrorsAreNotRetried(t *testing.T) {
+	for _, kind := range []error{ErrNotFound, ErrBadRequest} {
+		provider := &scriptedProvider{errs: []error{&ProviderError{Provider: "gated", Kind: kind}}}
+		service := NewService(map[string]ExchangeProvider{"gated": provider})
+
+		if _, err := service.FetchCandles(context.Background(), "gated", "X", 0, 60*299, 60); !errors.Is(err, kind) {
+			t.Errorf("got %v, want %v", err, kind)
+		}
+		if len(provider.attempts) != 1 {
+			t.Errorf("%v: got %d attempts, want 1", kind, len(provider.attempts))
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Market is one symbol on one provider.
+type Market struct {
+	Exchange string `json:"exchange"`
+	Symbol   string `json:"symbol"`
+}
+
+func (m Market) String() string {
+	return m.Exchange + ":" + m.Symbol
+}
+
+// FailoverGroup lists equivalent markets under a canonical name, most
+// preferred first.
+type FailoverGroup struct {
+	Name    string
+	Markets []Market
+}
+
+// ParseFailoverGroups reads groups separated by semicolons, each a name and
+// its markets: "BTC/USD=coinbase:BTC-USD,kraken:BTC/USD;ETH/USD=...".
+func ParseFailoverGroups(spec string) ([]FailoverGroup, error) {
+	var groups []FailoverGroup
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, list, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("failover group %q: expected name=exchange:symbol,...", part)
+		}
+
+		group := FailoverGroup{Name: strings.TrimSpace(name)}
+		for _, m := range strings.Split(list, ",") {
+			exchange, symbol, ok := strings.Cut(strings.TrimSpace(m), ":")
+			if !ok || exchange == "" || symbol == "" {
+				return nil, fmt.Errorf("failover group %s: bad market %q", group.Name, m)
+			}
+			group.Markets = append(group.Markets, Market{Exchange: exchange, Symbol: symbol})
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// route lists the markets to try for a request, the requested one first.
+// Symbols may be canonical. A request on no particular exchange goes to the
+// failover group of that name, or else to the instrument's preferred venue
+// alone; only failover groups fail over.
+func (s *Service) route(exchangeName, symbol string) []Market {
+	if exchangeName == "" {
+		for _, g := range s.Failover {
+			if g.Name == symbol || g.Name == normalizeSymbol(symbol) {
+				return g.Markets
+			}
+		}
+		if venues := s.Instruments.Venues(symbol); len(venues) > 0 {
+			return []Market{s.preferredVenue(venues)}
+		}
+	}
+
+	requested := Market{Exchange: exchangeName, Symbol: s.Instruments.Resolve(exchangeName, symbol)}
+	for _, g := range s.Failover {
+
+		member := false
+		for _, m := range g.Markets {
+			member = member || m == requested
+		}
+		if !member {
+			continue
+		}
+
+		markets := []Market{requested}
+		for _, m := range g.Markets {
+			if m != requested {
+				markets = append(markets, m)
+			}
+		}
+		return markets
+	}
+
+	return []Market{requested}
+}
+
+// preferredVenue picks the earliest of venues in VenueOrder, or the first
+// by exchange name when none is listed.
+func (s *Service) preferredVenue(venues []Market) Market {
+	for _, exchange := range s.VenueOrder {
+		for _, m := range venues {
+			if m.Exchange == exchange {
+				return m
+			}
+		}
+	}
+	return venues[0]
+}
+
+// Resolve picks the market a request for symbol on exchangeName goes to
+// first, translating canonical symbols.
+func (s *Service) Resolve(exchangeName, symbol string) Market {
+	return s.route(exchangeName, symbol)[0]
+}
+
+// withFailover runs fetch against each market of the request's group until
+// one succeeds and returns the market that served it. It only moves on when
+// the provider itself is in trouble; a request that is wrong for one market
+// would be wrong for all of them.
+func (s *Service) withFailover(ctx context.Context, exchangeName, symbol string, fetch func(Market) error) (Market, error) {
+	markets := s.route(exchangeName, symbol)
+
+	var err error
+	for i, m := range markets {
+		if _, ok := s.Providers[m.Exchange]; !ok {
+			err = fmt.Errorf("exchange %s not found", m.Exchange)
+			continue
+		}
+
+		if err = fetch(m); err == nil {
+			return m, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrBadRequest) {
+			return m, err
+		}
+		if i < len(markets)-1 {
+			log.Printf("Failing over from %s to %s: %v", m, markets[i+1], err)
+		}
+	}
+	return markets[len(markets)-1], err
+}
+
+// FetchTimeframeFrom is FetchTimeframe with failover, also reporting which
+// market the candles came from.
+func (s *Service) FetchTimeframeFrom(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe) ([]Candlestick, Market, error) {
+	var candles []Candlestick
+	source, err := s.withFailover(ctx, exchangeName, symbol, func(m Market) error {
+		var err error
+		candles, err = s.FetchTimeframe(ctx, m.Exchange, m.Symbol, start, end, tf)
+		return err
+	})
+	return candles, source, err
+}
+
+// FetchTimeframePartialFrom is FetchTimeframePartial with failover. It only
+// moves to another market when not a single block could be fetched.
+func (s *Service) FetchTimeframePartialFrom(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe) (CandleResult, error) {
+	var result CandleResult
+	source, err := s.withFailover(ctx, exchangeName, symbol, func(m Market) error {
+		var err error
+		result, err = s.FetchTimeframePartial(ctx, m.Exchange, m.Symbol, start, end, tf)
+		return err
+	})
+	result.Source = &source
+	return result, err
+}
+
+// FetchCandlesBeforeFrom is FetchCandlesBefore with failover.
+func (s *Service) FetchCandlesBeforeFrom(ctx context.Context, exchangeName, symbol string, before int64, limit int, tf Timeframe) (CandlePage, Market, error) {
+	var page CandlePage
+	source, err := s.withFailover(ctx, exchangeName, symbol, func(m Market) error {
+		var err error
+		page, err = s.FetchCandlesBefore(ctx, m.Exchange, m.Symbol, before, limit, tf)
+		return err
+	})
+	return page, source, err
+}
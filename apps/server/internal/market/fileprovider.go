@@ -0,0 +1,394 @@
+package market
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileProvider serves products and candles from a directory of CSV files,
+// one symbol per file named after it: otc-btc.csv is the symbol otc-btc.
+// Rows can be candles or single prints and are folded into whatever
+// granularity is asked for. A file is read again once it changes on disk.
+//
+// Columns are found by header name, or taken as time, open, high, low,
+// close, volume when there is no header. Timestamps without a zone are read
+// in Location, which a file can override with a leading
+// "# timezone: America/New_York" comment.
+//
+// Parquet isn't supported; there is no decoder in our dependencies, so
+// convert those files to CSV first.
+type FileProvider struct {
+	Dir      string
+	Location *time.Location
+
+	mu     sync.Mutex
+	series map[string]*fileSeries
+}
+
+type fileSeries struct {
+	modTime time.Time
+	size    int64
+	rows    []Candlestick
+}
+
+const fileExt = ".csv"
+
+func (f *FileProvider) ID() string {
+	return "file"
+}
+
+func (f *FileProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Granularities:        []int64{60, 180, 300, 900, 1800, 3600, 7200, 14400, 21600, 43200, 86400},
+		MaxCandlesPerRequest: 5000,
+		AssetTypes:           []string{"custom"},
+		Volatile:             true,
+	}
+}
+
+func (f *FileProvider) RateLimit() RateLimit {
+	return RateLimit{}
+}
+
+func (f *FileProvider) GetProducts() ([]Product, error) {
+	entries, err := os.ReadDir(f.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := make(map[string]bool, len(entries))
+	products := make([]Product, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(name), fileExt) {
+			continue
+		}
+
+		symbol := strings.TrimSuffix(name, filepath.Ext(name))
+		listed[symbol] = true
+		product := Product{
+			ID:       symbol,
+			Name:     strings.ToUpper(symbol),
+			Type:     "custom",
+			Exchange: "file",
+			Status:   StatusOnline,
+		}
+		// Files carry no metadata, so it is read off the data itself
+		if rows, err := f.load(symbol); err == nil && len(rows) > 0 {
+			product.PricePrecision = pricePrecision(rows[len(rows)-1].Close)
+		}
+		products = append(products, product)
+	}
+
+	// Forget files that have been removed
+	f.mu.Lock()
+	for symbol := range f.series {
+		if !listed[symbol] {
+			delete(f.series, symbol)
+		}
+	}
+	f.mu.Unlock()
+
+	return products, nil
+}
+
+func (f *FileProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	rows, err := f.load(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	tf := Timeframe{Seconds: granularity}
+	first := tf.BucketStart(start)
+	lo := sort.Search(len(rows), func(i int) bool { return rows[i].Timestamp >= first })
+	hi := sort.Search(len(rows), func(i int) bool { return rows[i].Timestamp >= tf.NextBucket(end) })
+
+	return Resample(rows[lo:hi], tf), nil
+}
+
+// load returns the sorted rows of a symbol, parsing the file again if it
+// changed since the last call.
+func (f *FileProvider) load(symbol string) ([]Candlestick, error) {
+	if symbol == "" || symbol != filepath.Base(symbol) || strings.HasPrefix(symbol, ".") {
+		return nil, &ProviderError{Provider: "file", Kind: ErrNotFound, Message: symbol}
+	}
+
+	path := filepath.Join(f.Dir, symbol+fileExt)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &ProviderError{Provider: "file", Kind: ErrNotFound, Message: symbol}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.series[symbol]; ok && s.modTime.Equal(info.ModTime()) && s.size == info.Size() {
+		return s.rows, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	rows, skipped, err := parseCandleCSV(data, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if f.series == nil {
+		f.series = make(map[string]*fileSeries)
+	}
+	f.series[symbol] = &fileSeries{modTime: info.ModTime(), size: info.Size(), rows: rows}
+	log.Printf("Loaded %d rows from %s, skipped %d unreadable", len(rows), path, skipped)
+	return rows, nil
+}
+
+// csvColumns holds the index of each field, -1 when the file lacks it.
+type csvColumns struct {
+	time, open, high, low, close, volume int
+}
+
+var csvAliases = map[string][]string{
+	"time":   {"time", "timestamp", "ts", "date", "datetime", "open_time", "opentime", "t"},
+	"open":   {"open", "o"},
+	"high":   {"high", "h"},
+	"low":    {"low", "l"},
+	"close":  {"close", "c", "price", "last", "px"},
+	"volume": {"volume", "vol", "v", "qty", "quantity", "size", "amount"},
+}
+
+// parseCandleCSV returns the rows sorted by time and how many could not be
+// read.
+func parseCandleCSV(data []byte, loc *time.Location) ([]Candlestick, int, error) {
+	loc, err := csvLocation(data, loc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comment = '#'
+	r.Comma = csvDelimiter(data)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(records) == 0 {
+		return []Candlestick{}, 0, nil
+	}
+
+	cols, hasHeader := detectColumns(records[0], loc)
+	if cols.time < 0 || cols.close < 0 {
+		return nil, 0, fmt.Errorf("no time and price columns in header %v", records[0])
+	}
+	if hasHeader {
+		records = records[1:]
+	}
+
+	rows := make([]Candlestick, 0, len(records))
+	skipped := 0
+	for _, record := range records {
+		c, err := parseCSVRow(record, cols, loc)
+		if err != nil {
+			skipped++
+			continue
+		}
+		rows = append(rows, c)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].Timestamp < rows[j].Timestamp
+	})
+	return rows, skipped, nil
+}
+
+// csvLocation looks for a "# timezone: <zone>" comment before the data.
+func csvLocation(data []byte, loc *time.Location) (*time.Location, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+
+		key, value, ok := strings.Cut(strings.TrimSpace(line[1:]), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "timezone") {
+			continue
+		}
+		return time.LoadLocation(strings.TrimSpace(value))
+	}
+	return loc, nil
+}
+
+// csvDelimiter picks whichever of comma, semicolon or tab splits the first
+// data line into the most fields.
+func csvDelimiter(data []byte) rune {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		best, count := ',', strings.Count(line, ",")
+		for _, d := range []rune{';', '\t'} {
+			if n := strings.Count(line, string(d)); n > count {
+				best, count = d, n
+			}
+		}
+		return best
+	}
+	return ','
+}
+
+// detectColumns maps a header row to column indexes. A first row that
+// already parses as data is taken to be headerless in the default order.
+func detectColumns(first []string, loc *time.Location) (csvColumns, bool) {
+	if _, err := parseFileTime(first[0], loc); err == nil {
+		cols := csvColumns{time: 0, open: -1, high: -1, low: -1, close: -1, volume: -1}
+		switch {
+		case len(first) >= 5:
+			cols.open, cols.high, cols.low, cols.close = 1, 2, 3, 4
+			if len(first) >= 6 {
+				cols.volume = 5
+			}
+		case len(first) >= 2:
+			cols.close = 1
+			if len(first) >= 3 {
+				cols.volume = 2
+			}
+		}
+		return cols, false
+	}
+
+	found := map[string]int{}
+	for i, name := range first {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for field, aliases := range csvAliases {
+			if _, ok := found[field]; ok {
+				continue
+			}
+			for _, alias := range aliases {
+				if name == alias {
+					found[field] = i
+				}
+			}
+		}
+	}
+
+	index := func(field string) int {
+		if i, ok := found[field]; ok {
+			return i
+		}
+		return -1
+	}
+	return csvColumns{
+		time:   index("time"),
+		open:   index("open"),
+		high:   index("high"),
+		low:    index("low"),
+		close:  index("close"),
+		volume: index("volume"),
+	}, true
+}
+
+func parseCSVRow(record []string, cols csvColumns, loc *time.Location) (Candlestick, error) {
+	field := func(i int) (float64, error) {
+		if i >= len(record) {
+			return 0, fmt.Errorf("missing column %d", i)
+		}
+		return strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+	}
+
+	if cols.time >= len(record) {
+		return Candlestick{}, fmt.Errorf("missing column %d", cols.time)
+	}
+	ts, err := parseFileTime(record[cols.time], loc)
+	if err != nil {
+		return Candlestick{}, err
+	}
+
+	closePrice, err := field(cols.close)
+	if err != nil {
+		return Candlestick{}, err
+	}
+	c := Candlestick{Timestamp: ts, Open: closePrice, High: closePrice, Low: closePrice, Close: closePrice}
+
+	// Prints only carry a price, candles fill in the rest
+	for _, f := range []struct {
+		col int
+		dst *float64
+	}{{cols.open, &c.Open}, {cols.high, &c.High}, {cols.low, &c.Low}, {cols.volume, &c.Volume}} {
+		if f.col < 0 {
+			continue
+		}
+		if *f.dst, err = field(f.col); err != nil {
+			return Candlestick{}, err
+		}
+	}
+	return c, nil
+}
+
+var fileTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+// parseFileTime reads epoch numbers in seconds through nanoseconds, picked
+// by magnitude, or any of fileTimeLayouts.
+func parseFileTime(s string, loc *time.Location) (int64, error) {
+	s = strings.TrimSpace(s)
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		switch {
+		case n > 1e17:
+			return n / 1e9, nil
+		case n > 1e14:
+			return n / 1e6, nil
+		case n > 1e11:
+			return n / 1e3, nil
+		}
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return int64(f), nil
+	}
+
+	for _, layout := range fileTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognised time %q", s)
+}
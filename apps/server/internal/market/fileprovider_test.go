@@ -0,0 +1,113 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCSV(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileProviderFoldsPrints(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "otc-btc.csv", `timestamp,price,size
+2024-06-01T12:04:00Z,103,1
+2024-06-01T12:00:30Z,100,2
+2024-06-01T12:01:00Z,105,1
+not a time,1,1
+2024-06-01T12:02:00Z,99,3
+2024-06-01T12:05:10Z,101,4
+`)
+	f := &FileProvider{Dir: dir}
+
+	got, err := f.FetchCandles(context.Background(), "otc-btc", utc(2024, 6, 1, 12, 0), utc(2024, 6, 1, 12, 5), 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Candlestick{
+		{Timestamp: utc(2024, 6, 1, 12, 0), Open: 100, High: 105, Low: 99, Close: 103, Volume: 7},
+		{Timestamp: utc(2024, 6, 1, 12, 5), Open: 101, High: 101, Low: 101, Close: 101, Volume: 4},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFileProviderFormats(t *testing.T) {
+	dir := t.TempDir()
+	// Headerless candles in milliseconds, split by semicolons
+	writeCSV(t, dir, "ms.csv", "1717243200000;1;2;0.5;1.5;10\n1717243260000;1.5;3;1;2;20\n")
+	// Local times in the file's own zone, 12:00 in New York is 16:00 UTC
+	writeCSV(t, dir, "ny.csv", "# timezone: America/New_York\ntime,open,high,low,close\n2024-06-01 12:00,1,1,1,1\n")
+	// Local times in the provider's zone
+	writeCSV(t, dir, "tokyo.csv", "date\tclose\n2024/06/01\t7\n")
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	f := &FileProvider{Dir: dir, Location: tokyo}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		symbol      string
+		granularity int64
+		want        Candlestick
+	}{
+		{"ms", 120, Candlestick{Timestamp: utc(2024, 6, 1, 12, 0), Open: 1, High: 3, Low: 0.5, Close: 2, Volume: 30}},
+		{"ny", 60, Candlestick{Timestamp: utc(2024, 6, 1, 16, 0), Open: 1, High: 1, Low: 1, Close: 1}},
+		{"tokyo", 3600, Candlestick{Timestamp: utc(2024, 5, 31, 15, 0), Open: 7, High: 7, Low: 7, Close: 7}},
+	} {
+		got, err := f.FetchCandles(ctx, tc.symbol, 0, 1<<32, tc.granularity)
+		if err != nil || len(got) != 1 || got[0] != tc.want {
+			t.Errorf("%s: got %+v %v, want %+v", tc.symbol, got, err, tc.want)
+		}
+	}
+}
+
+func TestFileProviderProducts(t *testing.T) {
+	dir := t.TempDir()
+	writeCSV(t, dir, "a.csv", "time,close\n1717243200,1.25\n")
+	writeCSV(t, dir, "b.CSV", "time,close\n1717243200,100\n")
+	writeCSV(t, dir, "notes.txt", "not a series")
+	f := &FileProvider{Dir: dir}
+	ctx := context.Background()
+
+	products, err := f.GetProducts()
+	if err != nil || len(products) != 2 || products[0].ID != "a" || products[0].PricePrecision == 0 {
+		t.Fatalf("got %+v %v, want a and b", products, err)
+	}
+
+	for _, symbol := range []string{"missing", "../a", ".hidden", ""} {
+		if _, err := f.FetchCandles(ctx, symbol, 0, 1<<32, 60); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%q: got %v, want not found", symbol, err)
+		}
+	}
+
+	// Changed files are read again
+	writeCSV(t, dir, "a.csv", "time,close\n1717243200,1.25\n1717243260,2.5\n")
+	if got, err := f.FetchCandles(ctx, "a", 0, 1<<32, 60); err != nil || len(got) != 2 {
+		t.Errorf("got %+v %v after the file grew, want both rows", got, err)
+	}
+
+	os.Remove(filepath.Join(dir, "a.csv"))
+	if products, _ := f.GetProducts(); len(products) != 1 {
+		t.Errorf("removed file still listed: %+v", products)
+	}
+	if _, err := f.FetchCandles(ctx, "a", 0, 1<<32, 60); !errors.Is(err, ErrNotFound) {
+		t.Errorf("removed file still served: %v", err)
+	}
+}
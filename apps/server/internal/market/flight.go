@@ -0,0 +1,72 @@
+package market
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flightGroup shares one upstream fetch between every concurrent caller
+// asking for the same block. The shared fetch is only cancelled once all of
+// its callers have given up on it, with the reason the last one gave up as
+// its cause.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	waiters int
+	cancel  context.CancelCauseFunc
+	data    []Candlestick
+	err     error
+}
+
+func (g *flightGroup) do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) ([]Candlestick, error)) ([]Candlestick, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+
+	call, ok := g.calls[key]
+	if !ok {
+		// The call outlives whichever caller happened to start it
+		callCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+		callCtx, stop := context.WithTimeout(callCtx, timeout)
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+
+		go func() {
+			call.data, call.err = fn(callCtx)
+			stop()
+			cancel(nil)
+
+			g.mu.Lock()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel(ctx.Err())
+			// Later callers start a fresh fetch instead of joining a dead one
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,135 @@
+package market
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedProvider counts upstream calls and holds each one until released.
+type gatedProvider struct {
+	calls     atomic.Int32
+	release   chan struct{}
+	cancelled atomic.Int32
+}
+
+func (p *gatedProvider) ID() string { return "gated" }
+
+func (p *gatedProvider) GetProducts() ([]Product, error) { return nil, nil }
+
+func (p *gatedProvider) RateLimit() RateLimit { return RateLimit{} }
+
+func (p *gatedProvider) Capabilities() Capabilities {
+	return Capabilities{Granularities: []int64{60}, MaxCandlesPerRequest: 300}
+}
+
+func (p *gatedProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	p.calls.Add(1)
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		p.cancelled.Add(1)
+		return nil, ctx.Err()
+	}
+
+	var candles []Candlestick
+	for t := start; t < end; t += granularity {
+		candles = append(candles, Candlestick{Timestamp: t, Open: 1, High: 1, Low: 1, Close: 1})
+	}
+	return candles, nil
+}
+
+func waitForCalls(t *testing.T, p *gatedProvider, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.calls.Load() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d provider calls, want %d", p.calls.Load(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentFetchesShareOneUpstreamCall(t *testing.T) {
+	provider := &gatedProvider{release: make(chan struct{})}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+
+	// One full block of 1m candles
+	start, end := int64(0), int64(60*300)
+
+	const callers = 25
+	var wg sync.WaitGroup
+	results := make([][]Candlestick, callers)
+	errs := make([]error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = service.FetchCandles(context.Background(), "gated", "BTC-USD", start, end, 60)
+		}()
+	}
+
+	waitForCalls(t, provider, 1)
+	// Give every caller the chance to pile onto the in-flight call
+	time.Sleep(50 * time.Millisecond)
+	close(provider.release)
+	wg.Wait()
+
+	if got := provider.calls.Load(); got != 1 {
+		t.Fatalf("%d callers made %d provider calls, want 1", callers, got)
+	}
+	for i := range callers {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if len(results[i]) != 300 {
+			t.Fatalf("caller %d got %d candles, want %d", i, len(results[i]), 300)
+		}
+	}
+}
+
+func TestSharedCallSurvivesUntilLastWaiterLeaves(t *testing.T) {
+	provider := &gatedProvider{release: make(chan struct{})}
+	service := NewService(map[string]ExchangeProvider{"gated": provider})
+	start, end := int64(0), int64(60*300)
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	ctxB, cancelB := context.WithCancel(context.Background())
+
+	errA := make(chan error, 1)
+	errB := make(chan error, 1)
+	go func() {
+		_, err := service.FetchCandles(ctxA, "gated", "ETH-USD", start, end, 60)
+		errA <- err
+	}()
+	waitForCalls(t, provider, 1)
+	go func() {
+		_, err := service.FetchCandles(ctxB, "gated", "ETH-USD", start, end, 60)
+		errB <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancelA()
+	if err := <-errA; err == nil {
+		t.Fatal("cancelled caller should see an error")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if provider.cancelled.Load() != 0 {
+		t.Fatal("shared call was cancelled while a caller was still waiting")
+	}
+
+	cancelB()
+	<-errB
+	deadline := time.Now().Add(2 * time.Second)
+	for provider.cancelled.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("shared call kept running after every caller left")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := provider.calls.Load(); got != 1 {
+		t.Fatalf("got %d provider calls, want 1", got)
+	}
+}
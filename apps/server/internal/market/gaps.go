@@ -0,0 +1,175 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type GapKind string
+
+const (
+	// GapFetchFailed covers a range we could not get from upstream
+	GapFetchFailed GapKind = "fetch_failed"
+	// GapNoData covers a range upstream answered for but had no candles in
+	GapNoData GapKind = "no_data"
+)
+
+type Gap struct {
+	Start  int64   `json:"start"`
+	End    int64   `json:"end"`
+	Kind   GapKind `json:"kind"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// CandleResult carries whatever candles could be fetched along with every
+// range that is missing from them and why.
+type CandleResult struct {
+	Candles []Candlestick `json:"candles"`
+	Gaps    []Gap         `json:"gaps"`
+	Source  *Market       `json:"source,omitempty"`
+}
+
+// span is an inclusive range of bucket starts that was fetched successfully.
+type span struct {
+	start, end int64
+}
+
+// FetchTimeframePartial is FetchTimeframe for callers that would rather have
+// the blocks that succeeded than nothing. It only fails outright when no
+// block could be fetched at all.
+func (s *Service) FetchTimeframePartial(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe) (CandleResult, error) {
+	if s.isNative(exchangeName, tf) {
+		return s.fetchCandlesPartial(ctx, exchangeName, symbol, start, end, tf)
+	}
+
+	var candles []Candlestick
+	var fetched []span
+	var gaps []Gap
+
+	first := tf.BucketStart(start)
+	for block := tf.blockStart(start); block <= end; block = tf.blockEnd(block) {
+		lo, hi := max(block, first), min(tf.blockEnd(block)-1, end)
+
+		data, err := s.resampledBlock(ctx, exchangeName, symbol, block, end, tf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return CandleResult{}, ctx.Err()
+			}
+			gaps = append(gaps, Gap{Start: lo, End: hi, Kind: GapFetchFailed, Reason: err.Error()})
+			continue
+		}
+
+		fetched = append(fetched, span{lo, hi})
+		for _, c := range data {
+			if c.Timestamp >= first && c.Timestamp <= end {
+				candles = append(candles, c)
+			}
+		}
+	}
+
+	return buildResult(candles, fetched, gaps, tf)
+}
+
+func (s *Service) fetchCandlesPartial(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe) (CandleResult, error) {
+	granularity := tf.Seconds
+	provider, blocks, err := s.plan(exchangeName, start, end, granularity)
+	if err != nil {
+		return CandleResult{}, err
+	}
+
+	// Blocks time out on their own and become gaps, only the caller giving
+	// up abandons the whole request
+	responses := make([]CandleResponse, 0, len(blocks))
+	for res := range s.fetchBlocks(ctx, provider, exchangeName, symbol, granularity, blocks) {
+		responses = append(responses, res)
+	}
+	if ctx.Err() != nil {
+		return CandleResult{}, ctx.Err()
+	}
+
+	var candles []Candlestick
+	var fetched []span
+	var gaps []Gap
+	for _, res := range responses {
+		b := blocks[res.Index]
+		lo, hi := max(b.Start, start), min(b.GridEnd-1, end)
+
+		if res.Error != nil {
+			gaps = append(gaps, Gap{Start: lo, End: hi, Kind: GapFetchFailed, Reason: res.Error.Error()})
+			continue
+		}
+		fetched = append(fetched, span{lo, hi})
+		candles = append(candles, res.Data...)
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Timestamp < candles[j].Timestamp
+	})
+	return buildResult(s.finishCandles(candles, exchangeName, symbol, start, end, granularity), fetched, gaps, tf)
+}
+
+func buildResult(candles []Candlestick, fetched []span, gaps []Gap, tf Timeframe) (CandleResult, error) {
+	if len(fetched) == 0 && len(gaps) > 0 {
+		return CandleResult{}, fmt.Errorf("every block failed, first: %s", gaps[0].Reason)
+	}
+
+	if candles == nil {
+		candles = []Candlestick{}
+	}
+
+	now := time.Now().Unix()
+	for _, sp := range fetched {
+		gaps = append(gaps, noDataGaps(candles, sp, tf, now)...)
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i].Start < gaps[j].Start
+	})
+
+	return CandleResult{Candles: candles, Gaps: mergeGaps(gaps)}, nil
+}
+
+// noDataGaps finds closed buckets inside a fetched span that have no candle.
+func noDataGaps(candles []Candlestick, sp span, tf Timeframe, now int64) []Gap {
+	i := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp >= sp.start })
+
+	var gaps []Gap
+	open := false
+	for bucket := tf.BucketStart(sp.start); bucket <= sp.end && tf.NextBucket(bucket) <= now; bucket = tf.NextBucket(bucket) {
+		if bucket < sp.start {
+			continue
+		}
+		for i < len(candles) && candles[i].Timestamp < bucket {
+			i++
+		}
+
+		if i < len(candles) && candles[i].Timestamp == bucket {
+			open = false
+			continue
+		}
+
+		if open {
+			gaps[len(gaps)-1].End = tf.NextBucket(bucket) - 1
+			continue
+		}
+		gaps = append(gaps, Gap{Start: bucket, End: tf.NextBucket(bucket) - 1, Kind: GapNoData})
+		open = true
+	}
+	return gaps
+}
+
+// mergeGaps joins sorted gaps of the same kind that touch.
+func mergeGaps(gaps []Gap) []Gap {
+	merged := make([]Gap, 0, len(gaps))
+	for _, g := range gaps {
+		n := len(merged)
+		if n > 0 && merged[n-1].Kind == g.Kind && merged[n-1].Reason == g.Reason && merged[n-1].End+1 >= g.Start {
+			merged[n-1].End = max(merged[n-1].End, g.End)
+			continue
+		}
+		merged = append(merged, g)
+	}
+	return merged
+}
@@ -0,0 +1,166 @@
+package market
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Instrument is a market independent of where it trades. Symbol is the
+// canonical BASE/QUOTE name and Venues holds the id each exchange uses for
+// it, e.g. BTC/USD is BTC-USD on coinbase and XXBTZUSD's BTC/USD on kraken.
+type Instrument struct {
+	Symbol     string            `json:"symbol"`
+	Base       string            `json:"base"`
+	Quote      string            `json:"quote"`
+	AssetClass string            `json:"assetClass"`
+	Venues     map[string]string `json:"venues"`
+}
+
+// CanonicalSymbol names a pair as BASE/QUOTE, or "" if either side is
+// unknown.
+func CanonicalSymbol(base, quote string) string {
+	if base == "" || quote == "" {
+		return ""
+	}
+	return strings.ToUpper(base) + "/" + strings.ToUpper(quote)
+}
+
+// normalizeSymbol lets canonical symbols be written as btc-usd or BTC_USD.
+func normalizeSymbol(symbol string) string {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if strings.Count(symbol, "/")+strings.Count(symbol, "-")+strings.Count(symbol, "_") == 1 {
+		symbol = strings.NewReplacer("-", "/", "_", "/").Replace(symbol)
+	}
+	return symbol
+}
+
+// Registry maps canonical symbols to venue ids and back.
+type Registry struct {
+	mu          sync.RWMutex
+	instruments map[string]*Instrument
+	canonical   map[Market]string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{instruments: make(map[string]*Instrument), canonical: make(map[Market]string)}
+}
+
+// Update replaces everything known about one exchange with its current
+// products, filling in their Canonical field.
+func (r *Registry) Update(exchange string, products []Product) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for m, symbol := range r.canonical {
+		if m.Exchange != exchange {
+			continue
+		}
+		delete(r.canonical, m)
+		if inst, ok := r.instruments[symbol]; ok {
+			delete(inst.Venues, exchange)
+			if len(inst.Venues) == 0 {
+				delete(r.instruments, symbol)
+			}
+		}
+	}
+
+	for i := range products {
+		p := &products[i]
+		p.Canonical = CanonicalSymbol(p.Base, p.Quote)
+		if p.Canonical == "" {
+			continue
+		}
+
+		inst, ok := r.instruments[p.Canonical]
+		if !ok {
+			inst = &Instrument{
+				Symbol:     p.Canonical,
+				Base:       strings.ToUpper(p.Base),
+				Quote:      strings.ToUpper(p.Quote),
+				AssetClass: p.Type,
+				Venues:     make(map[string]string),
+			}
+			r.instruments[p.Canonical] = inst
+		}
+		inst.Venues[exchange] = p.ID
+		r.canonical[Market{Exchange: exchange, Symbol: p.ID}] = p.Canonical
+	}
+}
+
+// Instrument looks up a canonical symbol.
+func (r *Registry) Instrument(symbol string) (Instrument, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inst, ok := r.instruments[normalizeSymbol(symbol)]
+	if !ok {
+		return Instrument{}, false
+	}
+
+	venues := make(map[string]string, len(inst.Venues))
+	for exchange, id := range inst.Venues {
+		venues[exchange] = id
+	}
+	copied := *inst
+	copied.Venues = venues
+	return copied, true
+}
+
+// Canonical returns the canonical symbol of a venue id.
+func (r *Registry) Canonical(exchange, venueID string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	symbol, ok := r.canonical[Market{Exchange: exchange, Symbol: venueID}]
+	return symbol, ok
+}
+
+// VenueID returns what exchange calls a canonical symbol.
+func (r *Registry) VenueID(exchange, symbol string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inst, ok := r.instruments[normalizeSymbol(symbol)]
+	if !ok {
+		return "", false
+	}
+	id, ok := inst.Venues[exchange]
+	return id, ok
+}
+
+// Resolve turns symbol into the id exchange expects. Venue ids are kept as
+// they are, canonical symbols are translated and anything else is passed
+// through for the provider to judge.
+func (r *Registry) Resolve(exchange, symbol string) string {
+	if r == nil {
+		return symbol
+	}
+	if _, ok := r.Canonical(exchange, symbol); ok {
+		return symbol
+	}
+	if id, ok := r.VenueID(exchange, symbol); ok {
+		return id
+	}
+	return symbol
+}
+
+// Venues lists every market trading a canonical symbol, by exchange name.
+func (r *Registry) Venues(symbol string) []Market {
+	if r == nil {
+		return nil
+	}
+	inst, ok := r.Instrument(symbol)
+	if !ok {
+		return nil
+	}
+
+	markets := make([]Market, 0, len(inst.Venues))
+	for exchange, id := range inst.Venues {
+		markets = append(markets, Market{Exchange: exchange, Symbol: id})
+	}
+	sort.Slice(markets, func(i, j int) bool {
+		return markets[i].Exchange < markets[j].Exchange
+	})
+	return markets
+}
@@ -0,0 +1,118 @@
+package market
+
+import "testing"
+
+func TestNormalizeSymbol(t *testing.T) {
+	for symbol, want := range map[string]string{
+		"BTC/USD":   "BTC/USD",
+		"btc-usd":   "BTC/USD",
+		" BTC_usd ": "BTC/USD",
+		"BTC-USD-P": "BTC-USD-P",
+		"XXBTZUSD":  "XXBTZUSD",
+		"BTC/USD-P": "BTC/USD-P",
+	} {
+		if got := normalizeSymbol(symbol); got != want {
+			t.Errorf("normalizeSymbol(%q) = %q, want %q", symbol, got, want)
+		}
+	}
+}
+
+func newTestRegistry() *Registry {
+	r := NewRegistry()
+	r.Update("coinbase", []Product{
+		{ID: "BTC-USD", Base: "BTC", Quote: "USD", Type: "crypto"},
+		{ID: "ETH-USD", Base: "ETH", Quote: "USD", Type: "crypto"},
+		{ID: "MYSTERY"},
+	})
+	r.Update("kraken", []Product{
+		{ID: "XBT/USD", Base: "btc", Quote: "usd", Type: "crypto"},
+	})
+	return r
+}
+
+func TestRegistryLookups(t *testing.T) {
+	r := newTestRegistry()
+
+	inst, ok := r.Instrument("btc-usd")
+	if !ok || inst.Symbol != "BTC/USD" || inst.Base != "BTC" || inst.Venues["coinbase"] != "BTC-USD" || inst.Venues["kraken"] != "XBT/USD" {
+		t.Fatalf("got %+v, %v, want BTC/USD on both exchanges", inst, ok)
+	}
+	// Callers get a copy
+	inst.Venues["binance"] = "BTCUSDT"
+	if _, ok := r.VenueID("binance", "BTC/USD"); ok {
+		t.Error("changing a returned instrument changed the registry")
+	}
+
+	for _, tc := range []struct {
+		exchange, id, canonical string
+	}{
+		{"coinbase", "BTC-USD", "BTC/USD"},
+		{"kraken", "XBT/USD", "BTC/USD"},
+		{"coinbase", "ETH-USD", "ETH/USD"},
+	} {
+		if got, ok := r.Canonical(tc.exchange, tc.id); !ok || got != tc.canonical {
+			t.Errorf("Canonical(%s, %s) = %q, %v, want %s", tc.exchange, tc.id, got, ok, tc.canonical)
+		}
+		if got, ok := r.VenueID(tc.exchange, tc.canonical); !ok || got != tc.id {
+			t.Errorf("VenueID(%s, %s) = %q, %v, want %s", tc.exchange, tc.canonical, got, ok, tc.id)
+		}
+	}
+
+	if _, ok := r.Canonical("coinbase", "MYSTERY"); ok {
+		t.Error("product without base and quote was given a canonical symbol")
+	}
+	if _, ok := r.VenueID("kraken", "ETH/USD"); ok {
+		t.Error("found ETH/USD on an exchange that doesn't list it")
+	}
+}
+
+func TestRegistryUpdateReplacesExchange(t *testing.T) {
+	r := newTestRegistry()
+	r.Update("coinbase", []Product{{ID: "SOL-USD", Base: "SOL", Quote: "USD"}})
+
+	if _, ok := r.Instrument("ETH/USD"); ok {
+		t.Error("instrument no exchange lists anymore was kept")
+	}
+	if _, ok := r.Canonical("coinbase", "BTC-USD"); ok {
+		t.Error("delisted venue id still maps to a canonical symbol")
+	}
+	inst, ok := r.Instrument("BTC/USD")
+	if !ok || len(inst.Venues) != 1 || inst.Venues["kraken"] != "XBT/USD" {
+		t.Errorf("got %+v, want BTC/USD left on kraken only", inst)
+	}
+	if id, ok := r.VenueID("coinbase", "SOL/USD"); !ok || id != "SOL-USD" {
+		t.Errorf("new listing not found: %q, %v", id, ok)
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := newTestRegistry()
+	for _, tc := range []struct {
+		exchange, symbol, want string
+	}{
+		{"kraken", "BTC/USD", "XBT/USD"},
+		{"kraken", "btc_usd", "XBT/USD"},
+		{"kraken", "XBT/USD", "XBT/USD"},
+		{"coinbase", "BTC-USD", "BTC-USD"},
+		{"coinbase", "eth/usd", "ETH-USD"},
+		{"kraken", "ETH/USD", "ETH/USD"},
+		{"coinbase", "UNKNOWN", "UNKNOWN"},
+	} {
+		if got := r.Resolve(tc.exchange, tc.symbol); got != tc.want {
+			t.Errorf("Resolve(%s, %s) = %q, want %q", tc.exchange, tc.symbol, got, tc.want)
+		}
+	}
+
+	var none *Registry
+	if got := none.Resolve("coinbase", "BTC/USD"); got != "BTC/USD" {
+		t.Errorf("nil registry resolved to %q", got)
+	}
+	if got := none.Venues("BTC/USD"); got != nil {
+		t.Errorf("nil registry has venues %v", got)
+	}
+
+	venues := r.Venues("btc-usd")
+	if len(venues) != 2 || venues[0] != (Market{"coinbase", "BTC-USD"}) || venues[1] != (Market{"kraken", "XBT/USD"}) {
+		t.Errorf("got venues %v, want coinbase then kraken", venues)
+	}
+}
@@ -0,0 +1,328 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// krakenOHLCLimit is how many entries the OHLC endpoint returns at most.
+// Kraken only serves the most recent ones, older ranges come back empty.
+const krakenOHLCLimit = 720
+
+// krakenAssets renames Kraken's legacy asset codes to common tickers.
+var krakenAssets = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// KrakenProvider serves Kraken spot pairs. Products use canonical BASE/QUOTE
+// ids which are mapped back to Kraken pair names such as XXBTZUSD.
+type KrakenProvider struct {
+	Client  *http.Client
+	BaseURL string
+
+	mu    sync.RWMutex
+	pairs map[string]string
+}
+
+func (k *KrakenProvider) ID() string {
+	return "kraken"
+}
+
+func (k *KrakenProvider) Capabilities() Capabilities {
+	// Weekly and fortnightly intervals are Monday/Thursday aligned, resample
+	// those instead. Only the latest krakenOHLCLimit candles of an interval
+	// are served, so history is a window rolling forward, e.g. 12 hours of
+	// minutes and about two years of days.
+	return Capabilities{
+		Granularities:        []int64{60, 300, 900, 1800, 3600, 14400, 86400},
+		MaxCandlesPerRequest: krakenOHLCLimit,
+		MaxHistoryCandles:    krakenOHLCLimit,
+		AssetTypes:           []string{"crypto"},
+	}
+}
+
+// RateLimit stays under the public endpoint allowance of roughly one call
+// per second.
+func (k *KrakenProvider) RateLimit() RateLimit {
+	return RateLimit{Rate: 1, Burst: 3}
+}
+
+type krakenResponse struct {
+	Error  []string        `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+type krakenPair struct {
+	Altname      string `json:"altname"`
+	WSName       string `json:"wsname"`
+	Base         string `json:"base"`
+	Quote        string `json:"quote"`
+	Status       string `json:"status"`
+	PairDecimals int    `json:"pair_decimals"`
+	LotDecimals  int    `json:"lot_decimals"`
+	OrderMin     string `json:"ordermin"`
+	TickSize     string `json:"tick_size"`
+	LeverageBuy  []int  `json:"leverage_buy"`
+}
+
+// krakenStatuses maps the pair states that still trade in some form.
+// Anything else, such as delisted, is dropped.
+var krakenStatuses = map[string]string{
+	"online":      StatusOnline,
+	"post_only":   StatusLimited,
+	"limit_only":  StatusLimited,
+	"cancel_only": StatusHalted,
+	"reduce_only": StatusHalted,
+}
+
+// priceIncrement prefers the published tick size, which some pairs set
+// coarser than their decimals allow.
+func (p krakenPair) priceIncrement() float64 {
+	if tick := parseIncrement(p.TickSize); tick > 0 {
+		return tick
+	}
+	return math.Pow10(-p.PairDecimals)
+}
+
+func (k *KrakenProvider) GetProducts() ([]Product, error) {
+	var raw map[string]krakenPair
+	if err := k.get(context.Background(), "/0/public/AssetPairs", nil, &raw); err != nil {
+		return nil, err
+	}
+
+	pairs := make(map[string]string, len(raw))
+	products := make([]Product, 0, len(raw))
+	for name, p := range raw {
+		// Dark pool pairs share the market with their .d-less sibling
+		status, ok := krakenStatuses[p.Status]
+		if !ok || strings.HasSuffix(name, ".d") {
+			continue
+		}
+
+		id := canonicalKrakenPair(p)
+		if id == "" {
+			continue
+		}
+		pairs[id] = name
+		base, quote, _ := strings.Cut(id, "/")
+		products = append(products, Product{
+			ID:       id,
+			Name:     base + quote,
+			Type:     "crypto",
+			Exchange: "kraken",
+			Base:     base,
+			Quote:    quote,
+
+			PriceIncrement: p.priceIncrement(),
+			SizeIncrement:  math.Pow10(-p.LotDecimals),
+			MinSize:        parseIncrement(p.OrderMin),
+			PricePrecision: p.PairDecimals,
+			SizePrecision:  p.LotDecimals,
+			Status:         status,
+			Spot:           true,
+			Margin:         len(p.LeverageBuy) > 0,
+		})
+	}
+
+	k.mu.Lock()
+	k.pairs = pairs
+	k.mu.Unlock()
+
+	return products, nil
+}
+
+// canonicalKrakenPair turns a pair into BASE/QUOTE using its websocket name,
+// which already drops the X/Z class prefixes, e.g. XXBTZUSD → XBT/USD → BTC/USD.
+func canonicalKrakenPair(p krakenPair) string {
+	base, quote, ok := strings.Cut(p.WSName, "/")
+	if !ok {
+		return ""
+	}
+	return krakenAsset(base) + "/" + krakenAsset(quote)
+}
+
+func krakenAsset(code string) string {
+	if renamed, ok := krakenAssets[code]; ok {
+		return renamed
+	}
+	return code
+}
+
+// pairName maps a canonical id to the Kraken pair. Ids that were never
+// listed are passed through, Kraken accepts altnames such as XBTUSD too.
+func (k *KrakenProvider) pairName(id string) string {
+	k.mu.RLock()
+	name, ok := k.pairs[id]
+	k.mu.RUnlock()
+	if ok {
+		return name
+	}
+	return strings.ReplaceAll(id, "/", "")
+}
+
+func (k *KrakenProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	if granularity%60 != 0 || !k.Capabilities().supports(granularity) {
+		return nil, &ProviderError{Provider: "kraken", Kind: ErrBadRequest, Message: fmt.Sprintf("no OHLC interval for %ds", granularity)}
+	}
+
+	pair := k.pairName(symbol)
+	params := map[string]string{
+		"pair":     pair,
+		"interval": strconv.FormatInt(granularity/60, 10),
+	}
+
+	var candles []Candlestick
+	since := start - 1
+	for {
+		params["since"] = strconv.FormatInt(since, 10)
+
+		var raw map[string]json.RawMessage
+		if err := k.get(ctx, "/0/public/OHLC", params, &raw); err != nil {
+			return nil, err
+		}
+
+		page, last, err := parseKrakenOHLC(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range page {
+			if c.Timestamp < start || c.Timestamp > end {
+				continue
+			}
+			// The newest row of a page is still forming and shows up again,
+			// settled, at the top of the next one
+			if n := len(candles); n > 0 && candles[n-1].Timestamp >= c.Timestamp {
+				if candles[n-1].Timestamp == c.Timestamp {
+					candles[n-1] = c
+				}
+				continue
+			}
+			candles = append(candles, c)
+		}
+
+		// last is the cursor for the following page. It stops moving once
+		// there is nothing newer.
+		if len(page) == 0 || last <= since || last >= end {
+			break
+		}
+		since = last
+	}
+
+	return candles, nil
+}
+
+// parseKrakenOHLC reads the result object, which holds the rows under the
+// pair name next to the `last` cursor. Rows are
+// [ time, "open", "high", "low", "close", "vwap", "volume", count ].
+func parseKrakenOHLC(raw map[string]json.RawMessage) ([]Candlestick, int64, error) {
+	var last int64
+	var rows [][]json.RawMessage
+	for key, value := range raw {
+		var err error
+		if key == "last" {
+			err = json.Unmarshal(value, &last)
+		} else {
+			err = json.Unmarshal(value, &rows)
+		}
+		if err != nil {
+			return nil, 0, parseError("kraken", err)
+		}
+	}
+
+	candles := make([]Candlestick, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 7 {
+			continue
+		}
+
+		var ts int64
+		if err := json.Unmarshal(row[0], &ts); err != nil {
+			return nil, 0, parseError("kraken", err)
+		}
+
+		var fields [6]float64
+		for i := range fields {
+			var s string
+			if err := json.Unmarshal(row[i+1], &s); err != nil {
+				return nil, 0, parseError("kraken", err)
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, 0, parseError("kraken", err)
+			}
+			fields[i] = f
+		}
+
+		candles = append(candles, Candlestick{
+			Timestamp: ts,
+			Open:      fields[0],
+			High:      fields[1],
+			Low:       fields[2],
+			Close:     fields[3],
+			Volume:    fields[5],
+		})
+	}
+	return candles, last, nil
+}
+
+func (k *KrakenProvider) get(ctx context.Context, path string, params map[string]string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", k.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	q := req.URL.Query()
+	for key, v := range params {
+		q.Set(key, v)
+	}
+	req.URL.RawQuery = q.Encode()
+	req.Header.Set("User-Agent", "Cochart-App")
+
+	res, err := k.Client.Do(req)
+	if err != nil {
+		return requestError("kraken", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errorFromResponse("kraken", res)
+	}
+
+	var body krakenResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return parseError("kraken", err)
+	}
+	if len(body.Error) > 0 {
+		return krakenError(body.Error)
+	}
+
+	if err := json.Unmarshal(body.Result, out); err != nil {
+		return parseError("kraken", err)
+	}
+	return nil
+}
+
+// krakenError classifies the error strings Kraken sends with a 200 status,
+// e.g. "EQuery:Unknown asset pair".
+func krakenError(messages []string) *ProviderError {
+	msg := strings.Join(messages, "; ")
+	e := &ProviderError{Provider: "kraken", Kind: ErrBadRequest, Message: msg}
+
+	switch {
+	case strings.Contains(msg, "Unknown asset pair"):
+		e.Kind = ErrNotFound
+	case strings.Contains(msg, "Rate limit"), strings.Contains(msg, "Too many requests"):
+		e.Kind = ErrRateLimited
+	case strings.HasPrefix(msg, "EService"):
+		e.Kind = ErrTransient
+	}
+	return e
+}
@@ -0,0 +1,170 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func newKrakenFixture(t *testing.T) (*KrakenProvider, *[]string) {
+	var sinces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			serveFixture(t, w, "kraken/AssetPairs.json", http.StatusOK)
+		case "/0/public/OHLC":
+			if q.Get("pair") != "XXBTZUSD" || q.Get("interval") != "60" {
+				serveFixture(t, w, "kraken/error_unknown_pair.json", http.StatusOK)
+				return
+			}
+
+			sinces = append(sinces, q.Get("since"))
+			switch q.Get("since") {
+			case "1717999199":
+				serveFixture(t, w, "kraken/OHLC_XXBTZUSD_60_page1.json", http.StatusOK)
+			case "1718006400":
+				serveFixture(t, w, "kraken/OHLC_XXBTZUSD_60_page2.json", http.StatusOK)
+			default:
+				serveFixture(t, w, "kraken/OHLC_XXBTZUSD_60_page3.json", http.StatusOK)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &KrakenProvider{Client: server.Client(), BaseURL: server.URL}, &sinces
+}
+
+func TestKrakenProductsUseCanonicalSymbols(t *testing.T) {
+	k, _ := newKrakenFixture(t)
+
+	products, err := k.GetProducts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+
+	want := []Product{
+		{ID: "BTC/USD", Name: "BTCUSD", Type: "crypto", Exchange: "kraken", Base: "BTC", Quote: "USD",
+			PriceIncrement: 0.1, SizeIncrement: 1e-8, MinSize: 0.0001, PricePrecision: 1, SizePrecision: 8,
+			Status: StatusOnline, Spot: true, Margin: true},
+		{ID: "DOGE/USD", Name: "DOGEUSD", Type: "crypto", Exchange: "kraken", Base: "DOGE", Quote: "USD",
+			PriceIncrement: 1e-7, SizeIncrement: 1e-8, MinSize: 40, PricePrecision: 7, SizePrecision: 8,
+			Status: StatusLimited, Spot: true},
+		{ID: "ETH/USD", Name: "ETHUSD", Type: "crypto", Exchange: "kraken", Base: "ETH", Quote: "USD",
+			PriceIncrement: 0.01, SizeIncrement: 1e-8, MinSize: 0.002, PricePrecision: 2, SizePrecision: 8,
+			Status: StatusOnline, Spot: true, Margin: true},
+	}
+	if len(products) != len(want) {
+		t.Fatalf("got %d products, want %d: %+v", len(products), len(want), products)
+	}
+	for i := range want {
+		if products[i] != want[i] {
+			t.Errorf("product %d = %+v, want %+v", i, products[i], want[i])
+		}
+	}
+
+	for id, pair := range map[string]string{"BTC/USD": "XXBTZUSD", "DOGE/USD": "XDGUSD", "SOL/USD": "SOLUSD"} {
+		if got := k.pairName(id); got != pair {
+			t.Errorf("pairName(%s) = %q, want %q", id, got, pair)
+		}
+	}
+}
+
+func TestKrakenFollowsLastCursor(t *testing.T) {
+	k, sinces := newKrakenFixture(t)
+	if _, err := k.GetProducts(); err != nil {
+		t.Fatal(err)
+	}
+
+	candles, err := k.FetchCandles(context.Background(), "BTC/USD", 1717999200, 1718013600, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTimes := []int64{1717999200, 1718002800, 1718006400, 1718010000}
+	if len(candles) != len(wantTimes) {
+		t.Fatalf("got %d candles, want %d: %+v", len(candles), len(wantTimes), candles)
+	}
+	for i, ts := range wantTimes {
+		if candles[i].Timestamp != ts {
+			t.Errorf("candle %d at %d, want %d", i, candles[i].Timestamp, ts)
+		}
+	}
+
+	// The forming candle from the first page is replaced by its settled copy
+	settled := Candlestick{Timestamp: 1718006400, Open: 69588, High: 69600, Low: 69301.2, Close: 69340, Volume: 50.190011}
+	if candles[2] != settled {
+		t.Errorf("candle 2 = %+v, want %+v", candles[2], settled)
+	}
+
+	want := []string{"1717999199", "1718006400", "1718010000"}
+	if len(*sinces) != len(want) {
+		t.Fatalf("requested since %v, want %v", *sinces, want)
+	}
+	for i := range want {
+		if (*sinces)[i] != want[i] {
+			t.Errorf("request %d since %s, want %s", i, (*sinces)[i], want[i])
+		}
+	}
+}
+
+func TestKrakenErrors(t *testing.T) {
+	k, _ := newKrakenFixture(t)
+
+	_, err := k.FetchCandles(context.Background(), "NOPE/USD", 1717999200, 1718013600, 3600)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown pair: got %v, want ErrNotFound", err)
+	}
+
+	_, err = k.FetchCandles(context.Background(), "BTC/USD", 1717999200, 1718013600, 180)
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("3m interval: got %v, want ErrBadRequest", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveFixture(t, w, "kraken/error_rate_limit.json", http.StatusOK)
+	}))
+	defer server.Close()
+
+	limited := &KrakenProvider{Client: server.Client(), BaseURL: server.URL}
+	if _, err := limited.GetProducts(); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("throttled: got %v, want ErrRateLimited", err)
+	}
+}
+
+func TestKrakenHistoryIsARollingWindow(t *testing.T) {
+	caps := (&KrakenProvider{}).Capabilities()
+	now := int64(1718000000)
+
+	for _, g := range []int64{60, 3600, 86400} {
+		start := caps.historyStart(g, now)
+		if want := now/g*g - (krakenOHLCLimit-1)*g; start != want {
+			t.Errorf("%ds history starts at %d, want %d", g, start, want)
+		}
+		if candles := (now/g*g-start)/g + 1; candles != krakenOHLCLimit {
+			t.Errorf("%ds window holds %d candles, want %d", g, candles, krakenOHLCLimit)
+		}
+	}
+
+	// Requests reaching past the window are cut to it, and ones entirely
+	// before it never reach upstream
+	service := NewService(map[string]ExchangeProvider{"kraken": &KrakenProvider{}})
+	end := time.Now().Unix()
+	_, blocks, err := service.plan("kraken", 0, end, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := caps.historyStart(3600, end); len(blocks) == 0 || blocks[0].Start > first || blocks[0].End <= first {
+		t.Errorf("plan starts with %+v, want the block holding %d", blocks, first)
+	}
+	if _, blocks, _ := service.plan("kraken", 0, 86400, 3600); len(blocks) != 0 {
+		t.Errorf("planned %d blocks for a range long out of the window", len(blocks))
+	}
+}
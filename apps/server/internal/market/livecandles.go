@@ -0,0 +1,333 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	CandleUpdate = "CANDLE_UPDATE"
+	CandleClosed = "CANDLE_CLOSED"
+)
+
+// maxLiveCandles bounds how many closed live candles are kept per series.
+const maxLiveCandles = 1000
+
+type CandleEvent struct {
+	Type        string      `json:"type"`
+	Exchange    string      `json:"exchange"`
+	Symbol      string      `json:"symbol"`
+	Granularity int64       `json:"granularity"`
+	Candle      Candlestick `json:"candle"`
+	// Partial is set for the bucket that was already open when tracking
+	// started. Its open and volume only cover the trades seen since, so
+	// clients should keep the historical open and volume and only take the
+	// high, low and close.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// CandleBuilder turns a tick stream into forming OHLCV candles for every
+// granularity it tracks. Closed candles are handed to the Service so that
+// FetchCandles can join them onto historical data.
+type CandleBuilder struct {
+	Service       *Service
+	Streamer      *Streamer
+	Granularities []int64
+
+	mu     sync.Mutex
+	series map[string]*liveSeries
+}
+
+type liveSeries struct {
+	exchange    string
+	symbol      string
+	since       int64
+	unsubscribe func()
+	bars        map[int64]*liveBar
+	closed      map[int64]int64
+	listeners   map[int]candleListener
+	nextID      int
+}
+
+// liveBar is a forming candle. A bar is partial when tracking started after
+// its bucket opened, so it is missing trades and must not reach the cache.
+type liveBar struct {
+	candle  Candlestick
+	partial bool
+}
+
+type candleListener struct {
+	granularity int64
+	fn          func(CandleEvent)
+}
+
+type candleDelivery struct {
+	fn    func(CandleEvent)
+	event CandleEvent
+}
+
+func NewCandleBuilder(service *Service, streamer *Streamer) *CandleBuilder {
+	granularities := make([]int64, 0, len(Timeframes))
+	for _, tf := range Timeframes {
+		if tf.Fixed() {
+			granularities = append(granularities, tf.Seconds)
+		}
+	}
+	sort.Slice(granularities, func(i, j int) bool { return granularities[i] < granularities[j] })
+
+	b := &CandleBuilder{
+		Service:       service,
+		Streamer:      streamer,
+		Granularities: granularities,
+		series:        make(map[string]*liveSeries),
+	}
+	b.StartCloser(context.Background(), time.Second)
+	return b
+}
+
+func seriesKey(exchange, symbol string) string {
+	return exchange + "|" + symbol
+}
+
+// Subscribe delivers candle events for symbol at granularity to fn until the
+// returned func is called. The underlying tick subscription is shared by all
+// listeners of a symbol.
+func (b *CandleBuilder) Subscribe(exchange, symbol string, granularity int64, fn func(CandleEvent)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := seriesKey(exchange, symbol)
+	s, ok := b.series[key]
+	if !ok {
+		s = b.newSeries(exchange, symbol, time.Now().Unix())
+		if b.Streamer != nil {
+			unsubscribe, err := b.Streamer.Subscribe(exchange, symbol, b.Apply)
+			if err != nil {
+				return nil, err
+			}
+			s.unsubscribe = unsubscribe
+		}
+		b.series[key] = s
+	}
+
+	id := s.nextID
+	s.nextID++
+	s.listeners[id] = candleListener{granularity: granularity, fn: fn}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(key, s, id) })
+	}, nil
+}
+
+func (b *CandleBuilder) unsubscribe(key string, s *liveSeries, id int) {
+	b.mu.Lock()
+	delete(s.listeners, id)
+	if len(s.listeners) > 0 || b.series[key] != s {
+		b.mu.Unlock()
+		return
+	}
+	delete(b.series, key)
+	b.mu.Unlock()
+
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+}
+
+func (b *CandleBuilder) newSeries(exchange, symbol string, since int64) *liveSeries {
+	return &liveSeries{
+		exchange:  exchange,
+		symbol:    symbol,
+		since:     since,
+		bars:      make(map[int64]*liveBar),
+		closed:    make(map[int64]int64),
+		listeners: make(map[int]candleListener),
+	}
+}
+
+// Apply folds a tick into the forming candles of its series. Ticks for
+// untracked symbols, or for a bucket that has already closed, are dropped.
+func (b *CandleBuilder) Apply(tick Tick) {
+	b.mu.Lock()
+	s, ok := b.series[seriesKey(tick.Exchange, tick.Symbol)]
+	if !ok {
+		b.mu.Unlock()
+		return
+	}
+
+	var deliveries []candleDelivery
+	for _, g := range b.Granularities {
+		bucket := tick.Timestamp / g * g
+		bar := s.bars[g]
+
+		if bar != nil && bucket > bar.candle.Timestamp {
+			deliveries = append(deliveries, b.close(s, g, bar)...)
+			bar = nil
+		}
+
+		if bar == nil {
+			if closed, ok := s.closed[g]; ok && bucket <= closed {
+				continue
+			}
+			bar = &liveBar{
+				candle: Candlestick{
+					Timestamp: bucket,
+					Open:      tick.Price,
+					High:      tick.Price,
+					Low:       tick.Price,
+					Close:     tick.Price,
+				},
+				partial: bucket < s.since,
+			}
+			s.bars[g] = bar
+		} else if bucket < bar.candle.Timestamp {
+			continue
+		}
+
+		bar.candle.High = max(bar.candle.High, tick.Price)
+		bar.candle.Low = min(bar.candle.Low, tick.Price)
+		bar.candle.Close = tick.Price
+		bar.candle.Volume += tick.Size
+
+		deliveries = append(deliveries, s.events(CandleUpdate, g, bar)...)
+	}
+	b.mu.Unlock()
+
+	deliver(deliveries)
+}
+
+// close finalizes a bar. It must be called with b.mu held.
+func (b *CandleBuilder) close(s *liveSeries, granularity int64, bar *liveBar) []candleDelivery {
+	delete(s.bars, granularity)
+	s.closed[granularity] = bar.candle.Timestamp
+	if !bar.partial && b.Service != nil {
+		b.Service.SaveLiveCandle(s.symbol, s.exchange, granularity, bar.candle)
+	}
+	return s.events(CandleClosed, granularity, bar)
+}
+
+func (s *liveSeries) events(kind string, granularity int64, bar *liveBar) []candleDelivery {
+	var deliveries []candleDelivery
+	for _, l := range s.listeners {
+		if l.granularity != granularity {
+			continue
+		}
+		deliveries = append(deliveries, candleDelivery{
+			fn: l.fn,
+			event: CandleEvent{
+				Type:        kind,
+				Exchange:    s.exchange,
+				Symbol:      s.symbol,
+				Granularity: granularity,
+				Candle:      bar.candle,
+				Partial:     bar.partial,
+			},
+		})
+	}
+	return deliveries
+}
+
+func deliver(deliveries []candleDelivery) {
+	for _, d := range deliveries {
+		d.fn(d.event)
+	}
+}
+
+// StartCloser closes bars whose bucket has ended even when no further tick
+// arrives, so quiet markets still produce CANDLE_CLOSED events.
+func (b *CandleBuilder) StartCloser(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				b.CloseExpired(now.Unix())
+			}
+		}
+	}()
+}
+
+func (b *CandleBuilder) CloseExpired(now int64) {
+	b.mu.Lock()
+	var deliveries []candleDelivery
+	for _, s := range b.series {
+		for g, bar := range s.bars {
+			if now >= bar.candle.Timestamp+g {
+				deliveries = append(deliveries, b.close(s, g, bar)...)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	deliver(deliveries)
+}
+
+func liveKey(symbol, exchange string, granularity int64) string {
+	return fmt.Sprintf("%s-%s-%d", symbol, exchange, granularity)
+}
+
+// SaveLiveCandle records a candle closed by the CandleBuilder.
+func (s *Service) SaveLiveCandle(symbol, exchange string, granularity int64, candle Candlestick) {
+	s.liveMx.Lock()
+	defer s.liveMx.Unlock()
+
+	key := liveKey(symbol, exchange, granularity)
+	candles := s.live[key]
+	if n := len(candles); n > 0 && candles[n-1].Timestamp >= candle.Timestamp {
+		return
+	}
+
+	candles = append(candles, candle)
+	if len(candles) > maxLiveCandles {
+		candles = candles[len(candles)-maxLiveCandles:]
+	}
+	s.live[key] = candles
+}
+
+func (s *Service) liveCandles(symbol, exchange string, start, end, granularity int64) []Candlestick {
+	s.liveMx.RLock()
+	defer s.liveMx.RUnlock()
+
+	candles := s.live[liveKey(symbol, exchange, granularity)]
+	i := sort.Search(len(candles), func(i int) bool { return candles[i].Timestamp >= start })
+
+	var result []Candlestick
+	for ; i < len(candles) && candles[i].Timestamp <= end; i++ {
+		result = append(result, candles[i])
+	}
+	return result
+}
+
+// mergeLive joins closed live candles onto historical ones. Historical data
+// wins wherever both have a candle, so nothing is counted twice; live candles
+// fill buckets the exchange has not published yet.
+func mergeLive(historical, live []Candlestick) []Candlestick {
+	if len(live) == 0 {
+		return historical
+	}
+
+	seen := make(map[int64]bool, len(historical))
+	for _, c := range historical {
+		seen[c.Timestamp] = true
+	}
+
+	merged := historical
+	for _, c := range live {
+		if !seen[c.Timestamp] {
+			merged = append(merged, c)
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Timestamp < merged[j].Timestamp
+	})
+	return merged
+}
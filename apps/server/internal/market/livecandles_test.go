@@ -0,0 +1,166 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+// testBuilder tracks SIM-BTC at one and five minutes without the background
+// closer, so tests decide when buckets end. base is the start of a five
+// minute bucket opening after tracking began.
+func testBuilder(t *testing.T) (b *CandleBuilder, events *[]CandleEvent, base int64) {
+	t.Helper()
+	b = &CandleBuilder{
+		Service:       NewService(map[string]ExchangeProvider{}),
+		Granularities: []int64{60, 300},
+		series:        make(map[string]*liveSeries),
+	}
+
+	events = &[]CandleEvent{}
+	if _, err := b.Subscribe("simulated", "SIM-BTC", 60, func(e CandleEvent) { *events = append(*events, e) }); err != nil {
+		t.Fatal(err)
+	}
+	return b, events, (time.Now().Unix()/300 + 1) * 300
+}
+
+func tick(at int64, price, size float64) Tick {
+	return Tick{Exchange: "simulated", Symbol: "SIM-BTC", Price: price, Size: size, Timestamp: at}
+}
+
+func TestCandleBuilderApply(t *testing.T) {
+	b, events, base := testBuilder(t)
+
+	b.Apply(tick(base+1, 10, 1))
+	b.Apply(tick(base+20, 12, 2))
+	b.Apply(tick(base+30, 9, 0))
+	b.Apply(tick(base+59, 11, 1))
+	b.Apply(Tick{Exchange: "simulated", Symbol: "SIM-ETH", Price: 1, Timestamp: base + 2})
+
+	if len(*events) != 4 {
+		t.Fatalf("got %d events, want 4", len(*events))
+	}
+	last := (*events)[3]
+	want := Candlestick{Timestamp: base, Open: 10, High: 12, Low: 9, Close: 11, Volume: 4}
+	if last.Type != CandleUpdate || last.Granularity != 60 || last.Candle != want || last.Partial {
+		t.Errorf("got %+v, want an update of %+v", last, want)
+	}
+}
+
+func TestCandleBuilderRollover(t *testing.T) {
+	b, events, base := testBuilder(t)
+
+	b.Apply(tick(base+10, 10, 1))
+	b.Apply(tick(base+70, 11, 2))
+
+	if len(*events) != 3 {
+		t.Fatalf("got %d events, want update, close and update", len(*events))
+	}
+	closed, opened := (*events)[1], (*events)[2]
+	if closed.Type != CandleClosed || closed.Candle != (Candlestick{Timestamp: base, Open: 10, High: 10, Low: 10, Close: 10, Volume: 1}) {
+		t.Errorf("unexpected close %+v", closed)
+	}
+	if opened.Type != CandleUpdate || opened.Candle.Timestamp != base+60 || opened.Candle.Open != 11 {
+		t.Errorf("unexpected update %+v", opened)
+	}
+
+	// A late tick for the closed bucket must not reopen it
+	b.Apply(tick(base+30, 50, 1))
+	if len(*events) != 3 {
+		t.Errorf("late tick produced %+v", (*events)[3:])
+	}
+
+	if saved := b.Service.liveCandles("SIM-BTC", "simulated", base, base, 60); len(saved) != 1 || saved[0] != closed.Candle {
+		t.Errorf("saved %+v, want the closed candle", saved)
+	}
+	// The five minute bar is still forming
+	if saved := b.Service.liveCandles("SIM-BTC", "simulated", base, base, 300); len(saved) != 0 {
+		t.Errorf("saved forming five minute bar %+v", saved)
+	}
+}
+
+func TestCandleBuilderPartialFirstBar(t *testing.T) {
+	b, events, base := testBuilder(t)
+	b.series[seriesKey("simulated", "SIM-BTC")].since = base + 30
+
+	b.Apply(tick(base+31, 10, 1))
+	if len(*events) != 1 || !(*events)[0].Partial {
+		t.Fatalf("got %+v, want one partial update", *events)
+	}
+
+	b.CloseExpired(base + 60)
+	if len(*events) != 2 || (*events)[1].Type != CandleClosed || !(*events)[1].Partial {
+		t.Fatalf("got %+v, want a partial close", *events)
+	}
+	if saved := b.Service.liveCandles("SIM-BTC", "simulated", base, base, 60); len(saved) != 0 {
+		t.Errorf("saved partial bar %+v", saved)
+	}
+
+	b.Apply(tick(base+61, 11, 1))
+	if e := (*events)[2]; e.Partial || e.Candle.Timestamp != base+60 {
+		t.Errorf("bar opened after tracking began marked partial: %+v", e)
+	}
+}
+
+func TestCandleBuilderCloseExpired(t *testing.T) {
+	b, events, base := testBuilder(t)
+	b.Apply(tick(base+5, 10, 1))
+
+	b.CloseExpired(base + 59)
+	if len(*events) != 1 {
+		t.Fatalf("closed a bar before its bucket ended: %+v", *events)
+	}
+
+	b.CloseExpired(base + 60)
+	if len(*events) != 2 || (*events)[1].Type != CandleClosed || (*events)[1].Candle.Timestamp != base {
+		t.Fatalf("got %+v, want the bar closed", *events)
+	}
+	if saved := b.Service.liveCandles("SIM-BTC", "simulated", base, base, 60); len(saved) != 1 {
+		t.Errorf("closed bar was not saved")
+	}
+
+	b.CloseExpired(base + 120)
+	if len(*events) != 2 {
+		t.Errorf("closed a bar twice: %+v", (*events)[2:])
+	}
+}
+
+func TestSaveLiveCandle(t *testing.T) {
+	s := NewService(map[string]ExchangeProvider{})
+
+	s.SaveLiveCandle("BTC-USD", "coinbase", 60, Candlestick{Timestamp: 120, Close: 2})
+	s.SaveLiveCandle("BTC-USD", "coinbase", 60, Candlestick{Timestamp: 60, Close: 1})
+	s.SaveLiveCandle("BTC-USD", "coinbase", 60, Candlestick{Timestamp: 120, Close: 3})
+
+	got := s.liveCandles("BTC-USD", "coinbase", 0, 1000, 60)
+	if len(got) != 1 || got[0].Close != 2 {
+		t.Errorf("got %+v, want only the first candle at 120", got)
+	}
+
+	for i := range maxLiveCandles + 10 {
+		s.SaveLiveCandle("ETH-USD", "coinbase", 60, Candlestick{Timestamp: int64(i) * 60})
+	}
+	got = s.liveCandles("ETH-USD", "coinbase", 0, 1<<40, 60)
+	if len(got) != maxLiveCandles || got[0].Timestamp != 600 {
+		t.Errorf("kept %d candles from %d, want %d from 600", len(got), got[0].Timestamp, maxLiveCandles)
+	}
+}
+
+func TestMergeLive(t *testing.T) {
+	historical := []Candlestick{{Timestamp: 0, Close: 1}, {Timestamp: 60, Close: 2}}
+	live := []Candlestick{{Timestamp: 60, Close: 20}, {Timestamp: 120, Close: 30}}
+
+	got := mergeLive(historical, live)
+	want := []Candlestick{{Timestamp: 0, Close: 1}, {Timestamp: 60, Close: 2}, {Timestamp: 120, Close: 30}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("candle %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if got := mergeLive(historical, nil); len(got) != 2 {
+		t.Errorf("merging nothing changed history: %+v", got)
+	}
+}
@@ -21,6 +21,13 @@ type CandleResponse struct {
 	Error error
 }
 
+// CandlePage is one page of a count based candle request. NextCursor is the
+// `before` value for the following page, or nil once history runs out.
+type CandlePage struct {
+	Candles    []Candlestick `json:"candles"`
+	NextCursor *int64        `json:"nextCursor"`
+}
+
 type CandleRequest struct {
 	Symbol      string
 	Start       int64
@@ -33,6 +40,8 @@ type ExchangeProvider interface {
 	ID() string
 	FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error)
 	GetProducts() ([]Product, error)
+	RateLimit() RateLimit
+	Capabilities() Capabilities
 }
 
 type Product struct {
@@ -40,24 +49,77 @@ type Product struct {
 	Name     string
 	Type     string
 	Exchange string
-}
-
-type CacheCandleBatch struct {
-	Data      []Candlestick
-	CreatedAt time.Time
+	Base     string
+	Quote    string
+	// Canonical is the venue independent BASE/QUOTE symbol, when known
+	Canonical string
+	// PriceIncrement and SizeIncrement are the smallest steps a price and
+	// an order size move in, MinSize the smallest order. Zero when unknown
+	PriceIncrement float64
+	SizeIncrement  float64
+	MinSize        float64
+	// PricePrecision and SizePrecision are the decimals to display with
+	PricePrecision int
+	SizePrecision  int
+	// Status is one of StatusOnline, StatusLimited or StatusHalted
+	Status string
+	Spot   bool
+	Margin bool
+	// Volume24h is the last day's traded volume in the quote currency, zero
+	// when the venue doesn't report it
+	Volume24h float64
+	// There is no listing date: the coinbase, binance and kraken product
+	// APIs don't report one
 }
 
 type Service struct {
 	Providers map[string]ExchangeProvider
+	// Store, when set, keeps settled history across restarts
+	Store *DiskStore
+	// Failover groups equivalent markets to fall back on
+	Failover []FailoverGroup
+	// VenueOrder ranks exchanges for canonical symbols no failover group
+	// names, most preferred first. Unlisted exchanges follow by name
+	VenueOrder []string
+	// Instruments maps canonical symbols to the markets trading them
+	Instruments *Registry
+	// Popularity counts which markets are being viewed
+	Popularity *Popularity
+	// BlockTimeout bounds the upstream fetch of a single block
+	BlockTimeout time.Duration
+
+	// Cache ID: <symbol>-<exchange>-<granularity or timeframe>-<startTime>
+	cache *candleCache
+	// Upstream block fetches currently in progress
+	flight flightGroup
+	// One request budget per provider, shared by every fetch
+	limiters map[string]*RateLimiter
+	breakers map[string]*Breaker
 
-	cacheMx sync.RWMutex
-	// Cache ID: <symbol>-<exchange>-<granularity>-<startTime>
-	cache map[string]CacheCandleBatch
+	liveMx sync.RWMutex
+	// Closed live candles, ID: <symbol>-<exchange>-<granularity>
+	live map[string][]Candlestick
 }
 
 func NewService(providers map[string]ExchangeProvider) *Service {
-	cache := make(map[string]CacheCandleBatch)
-	service := &Service{Providers: providers, cache: cache}
-	service.StartCachePruner(context.Background(), 5*time.Minute)
+	cache := newCandleCache(defaultCacheBytes)
+	limiters := make(map[string]*RateLimiter, len(providers))
+	breakers := make(map[string]*Breaker, len(providers))
+	for name, p := range providers {
+		limiters[name] = NewRateLimiter(p.RateLimit())
+		breakers[name] = NewBreaker(name, defaultBreakerThreshold, defaultBreakerCooldown)
+	}
+
+	service := &Service{
+		Providers:    providers,
+		Instruments:  NewRegistry(),
+		Popularity:   NewPopularity(),
+		BlockTimeout: blockTimeout,
+		cache:        cache,
+		live:         make(map[string][]Candlestick),
+		limiters:     limiters,
+		breakers:     breakers,
+	}
+	service.StartCachePruner(context.Background(), time.Minute)
 	return service
 }
@@ -0,0 +1,59 @@
+package market
+
+import (
+	"context"
+	"fmt"
+)
+
+const MaxPageLimit = 5000
+
+// maxEmptyWindows is how many consecutive windows without a single candle
+// are searched before history is considered exhausted.
+const maxEmptyWindows = 3
+
+// FetchCandlesBefore returns the limit most recent candles strictly before
+// the given timestamp, oldest first. Windows are walked backwards over the
+// same block-aligned cache FetchCandles uses, so scrolling left keeps hitting
+// cached blocks.
+func (s *Service) FetchCandlesBefore(ctx context.Context, exchangeName, symbol string, before int64, limit int, tf Timeframe) (CandlePage, error) {
+	if limit <= 0 || limit > MaxPageLimit {
+		return CandlePage{}, fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+	}
+
+	collected := []Candlestick{}
+	end := before - 1
+	empty := 0
+
+	for len(collected) < limit && empty < maxEmptyWindows && end > 0 {
+		// Windows start on a bucket, so the bucket a window starts in is
+		// never asked for again by the next one
+		need := int64(limit - len(collected))
+		start := tf.BucketStart(max(end-need*tf.Nominal()+1, 0))
+
+		candles, err := s.FetchTimeframe(ctx, exchangeName, symbol, start, end, tf)
+		if err != nil {
+			return CandlePage{}, err
+		}
+
+		if len(candles) == 0 {
+			empty++
+		} else {
+			empty = 0
+		}
+
+		collected = append(candles, collected...)
+		end = start - 1
+	}
+
+	page := CandlePage{Candles: collected}
+	if len(collected) > limit {
+		page.Candles = collected[len(collected)-limit:]
+	}
+
+	if len(page.Candles) == limit {
+		cursor := page.Candles[0].Timestamp
+		page.NextCursor = &cursor
+	}
+
+	return page, nil
+}
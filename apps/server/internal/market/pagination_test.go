@@ -0,0 +1,133 @@
+package market
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// historyProvider has candles from From onwards at every granularity it
+// declares, except inside the hole.
+type historyProvider struct {
+	From               int64
+	HoleStart, HoleEnd int64
+	calls              atomic.Int32
+}
+
+func (p *historyProvider) ID() string { return "history" }
+
+func (p *historyProvider) GetProducts() ([]Product, error) { return nil, nil }
+
+func (p *historyProvider) RateLimit() RateLimit { return RateLimit{} }
+
+func (p *historyProvider) Capabilities() Capabilities {
+	return Capabilities{Granularities: []int64{60, 3600, day}, MaxCandlesPerRequest: 300}
+}
+
+func (p *historyProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	p.calls.Add(1)
+	var candles []Candlestick
+	for t := floorDiv(start, granularity) * granularity; t <= end; t += granularity {
+		if t < start || t < p.From || (t >= p.HoleStart && t < p.HoleEnd) {
+			continue
+		}
+		candles = append(candles, Candlestick{Timestamp: t, Open: 1, High: 1, Low: 1, Close: 1, Volume: 1})
+	}
+	return candles, nil
+}
+
+func TestFetchCandlesBefore(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		tf                 string
+		before             int64
+		limit              int
+		holeStart, holeEnd int64
+	}{
+		{"aligned", "1H", utc(2024, 6, 1, 12, 0), 10, 0, 0},
+		{"unaligned", "15m", utc(2024, 6, 1, 12, 7) + 13, 20, 0, 0},
+		{"unaligned over a hole", "15m", utc(2024, 6, 1, 12, 7), 20, utc(2024, 6, 1, 9, 0), utc(2024, 6, 1, 11, 0)},
+		{"weeks over a hole", "1W", utc(2024, 6, 5, 12, 0), 8, utc(2024, 4, 1, 0, 0), utc(2024, 5, 6, 0, 0)},
+		{"months over a hole", "1M", utc(2024, 7, 4, 0, 0), 6, utc(2024, 2, 1, 0, 0), utc(2024, 5, 1, 0, 0)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewService(map[string]ExchangeProvider{"history": &historyProvider{HoleStart: tc.holeStart, HoleEnd: tc.holeEnd}})
+			tf := Timeframes[tc.tf]
+
+			page, err := service.FetchCandlesBefore(context.Background(), "history", "X", tc.before, tc.limit, tf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Candles) != tc.limit {
+				t.Fatalf("got %d candles, want %d", len(page.Candles), tc.limit)
+			}
+
+			for i, c := range page.Candles {
+				if c.Timestamp != tf.BucketStart(c.Timestamp) {
+					t.Errorf("candle %d at %d is not on a bucket boundary", i, c.Timestamp)
+				}
+				if i > 0 && c.Timestamp <= page.Candles[i-1].Timestamp {
+					t.Fatalf("candle %d at %d follows %d", i, c.Timestamp, page.Candles[i-1].Timestamp)
+				}
+			}
+			if last := page.Candles[tc.limit-1].Timestamp; last >= tc.before || tf.NextBucket(last) <= tc.before-1 {
+				t.Errorf("last candle at %d, want the bucket holding %d", last, tc.before-1)
+			}
+			if page.NextCursor == nil || *page.NextCursor != page.Candles[0].Timestamp {
+				t.Errorf("cursor %v, want the first candle %d", page.NextCursor, page.Candles[0].Timestamp)
+			}
+		})
+	}
+}
+
+func TestFetchCandlesBeforeFollowsCursor(t *testing.T) {
+	service := NewService(map[string]ExchangeProvider{"history": &historyProvider{}})
+	tf := Timeframes["1M"]
+	ctx := context.Background()
+
+	first, err := service.FetchCandlesBefore(ctx, "history", "X", utc(2024, 7, 15, 0, 0), 4, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.FetchCandlesBefore(ctx, "history", "X", *first.NextCursor, 4, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pages join up without repeating or skipping a month
+	joined := append(second.Candles, first.Candles...)
+	for i := 1; i < len(joined); i++ {
+		if joined[i].Timestamp != tf.NextBucket(joined[i-1].Timestamp) {
+			t.Fatalf("candle at %d follows %d", joined[i].Timestamp, joined[i-1].Timestamp)
+		}
+	}
+	if start := time.Unix(joined[0].Timestamp, 0).UTC(); start.Month() != time.December || start.Year() != 2023 {
+		t.Errorf("second page starts %s, want 2023-12", start)
+	}
+}
+
+func TestFetchCandlesBeforeRunsOutOfHistory(t *testing.T) {
+	before := utc(2024, 6, 1, 12, 0)
+	provider := &historyProvider{From: before - 5*3600}
+	service := NewService(map[string]ExchangeProvider{"history": provider})
+
+	page, err := service.FetchCandlesBefore(context.Background(), "history", "X", before, 50, Timeframes["1H"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Candles) != 5 {
+		t.Errorf("got %d candles, want the 5 there are", len(page.Candles))
+	}
+	if page.NextCursor != nil {
+		t.Errorf("cursor %d, want none once history runs out", *page.NextCursor)
+	}
+	// The first window, then maxEmptyWindows more of a block or two each
+	if calls := provider.calls.Load(); calls > 2*(maxEmptyWindows+1) {
+		t.Errorf("made %d upstream calls looking for more history", calls)
+	}
+
+	if _, err := service.FetchCandlesBefore(context.Background(), "history", "X", before, MaxPageLimit+1, Timeframes["1H"]); err == nil {
+		t.Error("limit over MaxPageLimit was accepted")
+	}
+}
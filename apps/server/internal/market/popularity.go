@@ -0,0 +1,185 @@
+package market
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTrendingHalfLife = time.Hour
+	defaultPopularHalfLife  = 7 * 24 * time.Hour
+	defaultViewDebounce     = 5 * time.Minute
+
+	// maxViewers bounds the debounce memory, older entries are forgotten
+	// first
+	maxViewers = 10000
+	// minPopularity is the decayed count below which a market is dropped
+	minPopularity = 0.01
+	// minTrending is the decayed count a market needs to be trending, about
+	// one view in the last half life
+	minTrending = 0.5
+)
+
+// Popularity keeps decayed view counts per market. Each view adds one to
+// a trending count halving every TrendingHalfLife and a popular count
+// halving every PopularHalfLife, so the first follows what is being looked
+// at now and the second what is looked at over weeks. Repeat views of a
+// market by the same viewer within Debounce count once, as a chart
+// fetches candles many times while scrolled.
+type Popularity struct {
+	TrendingHalfLife time.Duration
+	PopularHalfLife  time.Duration
+	Debounce         time.Duration
+
+	mu     sync.Mutex
+	counts map[Market]*viewCount
+	seen   map[viewKey]time.Time
+}
+
+type viewCount struct {
+	trending float64
+	popular  float64
+	at       time.Time
+}
+
+type viewKey struct {
+	market Market
+	viewer string
+}
+
+// MarketScore is a market's decayed view counts.
+type MarketScore struct {
+	Market   Market  `json:"market"`
+	Trending float64 `json:"trending"`
+	Popular  float64 `json:"popular"`
+}
+
+func NewPopularity() *Popularity {
+	return &Popularity{
+		TrendingHalfLife: defaultTrendingHalfLife,
+		PopularHalfLife:  defaultPopularHalfLife,
+		Debounce:         defaultViewDebounce,
+		counts:           make(map[Market]*viewCount),
+		seen:             make(map[viewKey]time.Time),
+	}
+}
+
+// RecordView counts a view of m by viewer. It is safe on a nil Popularity.
+func (p *Popularity) RecordView(m Market, viewer string) {
+	p.recordAt(m, viewer, time.Now())
+}
+
+func (p *Popularity) recordAt(m Market, viewer string, now time.Time) {
+	if p == nil || m.Exchange == "" || m.Symbol == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := viewKey{m, viewer}
+	if last, ok := p.seen[key]; ok && now.Sub(last) < p.Debounce {
+		return
+	}
+	p.seen[key] = now
+	if len(p.seen) > maxViewers {
+		p.forgetViewers(now)
+	}
+
+	c, ok := p.counts[m]
+	if !ok {
+		c = &viewCount{at: now}
+		p.counts[m] = c
+	}
+	p.decay(c, now)
+	c.trending++
+	c.popular++
+}
+
+// forgetViewers drops debounce entries that no longer matter, and the
+// oldest half of the rest if that is not enough.
+func (p *Popularity) forgetViewers(now time.Time) {
+	for k, at := range p.seen {
+		if now.Sub(at) >= p.Debounce {
+			delete(p.seen, k)
+		}
+	}
+	if len(p.seen) <= maxViewers {
+		return
+	}
+
+	times := make([]time.Time, 0, len(p.seen))
+	for _, at := range p.seen {
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	cutoff := times[len(times)/2]
+	for k, at := range p.seen {
+		if at.Before(cutoff) {
+			delete(p.seen, k)
+		}
+	}
+}
+
+func (p *Popularity) decay(c *viewCount, now time.Time) {
+	elapsed := now.Sub(c.at)
+	if elapsed <= 0 {
+		return
+	}
+	c.trending *= halving(elapsed, p.TrendingHalfLife)
+	c.popular *= halving(elapsed, p.PopularHalfLife)
+	c.at = now
+}
+
+func halving(elapsed, halfLife time.Duration) float64 {
+	if halfLife <= 0 {
+		return 0
+	}
+	return math.Exp2(-elapsed.Seconds() / halfLife.Seconds())
+}
+
+// Scores returns every market's counts as of now, forgetting markets whose
+// counts have decayed to nothing.
+func (p *Popularity) Scores() map[Market]MarketScore {
+	return p.scoresAt(time.Now())
+}
+
+func (p *Popularity) scoresAt(now time.Time) map[Market]MarketScore {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	scores := make(map[Market]MarketScore, len(p.counts))
+	for m, c := range p.counts {
+		p.decay(c, now)
+		if c.popular < minPopularity {
+			delete(p.counts, m)
+			continue
+		}
+		scores[m] = MarketScore{Market: m, Trending: c.trending, Popular: c.popular}
+	}
+	return scores
+}
+
+// topMarkets orders the markets scoring at least floor by by, highest
+// first.
+func topMarkets(scores map[Market]MarketScore, floor float64, by func(MarketScore) float64) []MarketScore {
+	top := make([]MarketScore, 0, len(scores))
+	for _, s := range scores {
+		if by(s) >= floor {
+			top = append(top, s)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if a, b := by(top[i]), by(top[j]); a != b {
+			return a > b
+		}
+		return top[i].Market.String() < top[j].Market.String()
+	})
+	return top
+}
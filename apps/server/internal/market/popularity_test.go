@@ -0,0 +1,112 @@
+package market
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPopularityDecays(t *testing.T) {
+	p := NewPopularity()
+	btc := Market{Exchange: "coinbase", Symbol: "BTC-USD"}
+	start := time.Unix(1718000000, 0)
+
+	p.recordAt(btc, "a", start)
+	p.recordAt(btc, "b", start)
+
+	s := p.scoresAt(start.Add(p.TrendingHalfLife))[btc]
+	if math.Abs(s.Trending-1) > 1e-9 {
+		t.Errorf("trending after one half life = %v, want 1", s.Trending)
+	}
+	if s.Popular < 1.99 {
+		t.Errorf("popular after an hour = %v, want about 2", s.Popular)
+	}
+
+	s = p.scoresAt(start.Add(p.PopularHalfLife))[btc]
+	if math.Abs(s.Popular-1) > 1e-9 {
+		t.Errorf("popular after one half life = %v, want 1", s.Popular)
+	}
+
+	if _, ok := p.scoresAt(start.Add(10 * p.PopularHalfLife))[btc]; ok {
+		t.Error("market kept after decaying to nothing")
+	}
+}
+
+func TestPopularityDebouncesViewers(t *testing.T) {
+	p := NewPopularity()
+	btc := Market{Exchange: "coinbase", Symbol: "BTC-USD"}
+	start := time.Unix(1718000000, 0)
+
+	// A chart scrolling back fetches candles again and again
+	for i := range 10 {
+		p.recordAt(btc, "a", start.Add(time.Duration(i)*time.Second))
+	}
+	if s := p.scoresAt(start.Add(10 * time.Second))[btc]; s.Popular > 1.01 {
+		t.Errorf("repeat views counted: %v", s.Popular)
+	}
+
+	p.recordAt(btc, "a", start.Add(p.Debounce+time.Second))
+	if s := p.scoresAt(start.Add(p.Debounce + time.Second))[btc]; s.Popular < 1.9 {
+		t.Errorf("view after debounce not counted: %v", s.Popular)
+	}
+
+	var nilPopularity *Popularity
+	nilPopularity.RecordView(btc, "a")
+	if nilPopularity.Scores() != nil {
+		t.Error("nil Popularity has scores")
+	}
+}
+
+func TestPopularityBoostsSearch(t *testing.T) {
+	engine := newRelevanceEngine()
+	engine.Popularity = NewPopularity()
+
+	if got := pairsOf(engine.Search("eth", 10)); got[0] != "ETH/USD" {
+		t.Fatalf("Search(eth) starts with %v", got)
+	}
+
+	for i := range 50 {
+		engine.Popularity.RecordView(Market{Exchange: "binance", Symbol: "ETH/USDT"}, string(rune('a'+i)))
+	}
+	if got := engine.Search("eth", 10); got[0].ID != "ETH/USDT" {
+		t.Errorf("popular ETH/USDT not first: %v", pairsOf(got))
+	}
+
+	// Views cannot outweigh a clearly better text match
+	if got := engine.Search("eth btc", 10); got[0].ID != "ETH-BTC" && got[0].ID != "ETH/BTC" {
+		t.Errorf("Search(eth btc) starts with %s", got[0].ID)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	engine := newRelevanceEngine()
+	engine.Popularity = NewPopularity()
+
+	// Without views the most traded markets stand in
+	s := engine.Suggest(3)
+	if len(s.Trending) != 0 || len(s.Popular) != 3 || s.Popular[0].Base != "BTC" {
+		t.Fatalf("suggestions without views = %+v", s)
+	}
+
+	sol := Market{Exchange: "coinbase", Symbol: "SOL-USD"}
+	xmr := Market{Exchange: "kraken", Symbol: "XMR/USD"}
+	gone := Market{Exchange: "coinbase", Symbol: "GONE-USD"}
+	for _, viewer := range []string{"a", "b", "c"} {
+		engine.Popularity.RecordView(sol, viewer)
+		engine.Popularity.RecordView(gone, viewer)
+	}
+	engine.Popularity.RecordView(xmr, "a")
+
+	s = engine.Suggest(3)
+	if len(s.Trending) != 2 || s.Trending[0].ID != "SOL-USD" || s.Trending[1].ID != "XMR/USD" {
+		t.Errorf("trending = %+v", s.Trending)
+	}
+	if len(s.Popular) != 3 || s.Popular[0].ID != "SOL-USD" || s.Popular[1].ID != "XMR/USD" {
+		t.Errorf("popular = %+v", s.Popular)
+	}
+	for _, p := range append(s.Trending, s.Popular...) {
+		if p.ID == "GONE-USD" {
+			t.Error("unlisted market suggested")
+		}
+	}
+}
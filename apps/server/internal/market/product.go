@@ -0,0 +1,48 @@
+package market
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Trading status of a product, the same across exchanges
+const (
+	// StatusOnline trades normally
+	StatusOnline = "online"
+	// StatusLimited only takes some orders, such as limit or post only
+	StatusLimited = "limited"
+	// StatusHalted is listed but not matching orders
+	StatusHalted = "halted"
+)
+
+// decimalsOf is the number of decimals an increment written by an exchange
+// needs, so "0.01000000" gives 2 and "1.00000000" gives 0.
+func decimalsOf(increment string) int {
+	_, frac, ok := strings.Cut(increment, ".")
+	if !ok {
+		return 0
+	}
+	return len(strings.TrimRight(frac, "0"))
+}
+
+// parseIncrement reads a decimal string, treating anything unreadable as
+// unknown.
+func parseIncrement(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// pricePrecision picks the decimals to show a price with when the market
+// does not publish a tick size, keeping about six significant digits and
+// never fewer than two decimals.
+func pricePrecision(price float64) int {
+	if price <= 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return 2
+	}
+	digits := int(math.Floor(math.Log10(price))) + 1
+	return min(max(6-digits, 2), 12)
+}
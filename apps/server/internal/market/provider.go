@@ -2,109 +2,262 @@ package market
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
 
-const maxCandlesPerRequest = 300
 const maxConcurrentRequests = 10
+const maxAttempts = 3
+const blockTimeout = 30 * time.Second
 
-func (s *Service) FetchCandles(ctx context.Context, exchangeName, symbol string, start, end, granularity int64) ([]Candlestick, error) {
-	provider, exists := s.Providers[exchangeName]
-	if !exists {
-		return nil, fmt.Errorf("exchange %s not found", exchangeName)
-	}
+// candleBlock is one block-aligned slice of a candle request. A block owns
+// the candles in [Start, GridEnd); blocks cut short by the requested range
+// are partial and never cached.
+type candleBlock struct {
+	Index   int
+	Start   int64
+	End     int64
+	GridEnd int64
+	Partial bool
+}
 
-	blockDuration := granularity * int64(maxCandlesPerRequest)
+func planBlocks(start, end, granularity int64, candlesPerBlock int) []candleBlock {
+	blockDuration := granularity * int64(candlesPerBlock)
 	alignedStart := (start / blockDuration) * blockDuration
 
-	var batchStarts []int64
+	var blocks []candleBlock
 	for t := alignedStart; t < end; t += blockDuration {
-		batchStarts = append(batchStarts, t)
+		gridEnd := t + blockDuration
+
+		reqEnd := gridEnd
+		if reqEnd > end {
+			reqEnd = end
+		}
+
+		blocks = append(blocks, candleBlock{
+			Index:   len(blocks),
+			Start:   t,
+			End:     reqEnd,
+			GridEnd: gridEnd,
+			Partial: reqEnd < gridEnd,
+		})
 	}
+	return blocks
+}
 
-	responseChan := make(chan CandleResponse, len(batchStarts))
-	sem := make(chan struct{}, maxConcurrentRequests)
+func (s *Service) FetchCandles(ctx context.Context, exchangeName, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	provider, blocks, err := s.plan(exchangeName, start, end, granularity)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, blockTimeout)
 	defer cancel()
+
+	responseChan := s.fetchBlocks(ctx, provider, exchangeName, symbol, granularity, blocks)
+
+	fullData, err := collectResponses(responseChan, len(blocks))
+	if err != nil {
+		return []Candlestick{}, err
+	}
+
+	return s.finishCandles(fullData, exchangeName, symbol, start, end, granularity), nil
+}
+
+// finishCandles trims fetched candles to the requested range and joins any
+// closed live candles onto them.
+func (s *Service) finishCandles(candles []Candlestick, exchangeName, symbol string, start, end, granularity int64) []Candlestick {
+	filteredData := make([]Candlestick, 0, len(candles))
+	for _, c := range candles {
+		if c.Timestamp >= start && c.Timestamp <= end {
+			filteredData = append(filteredData, c)
+		}
+	}
+
+	return mergeLive(filteredData, s.liveCandles(symbol, exchangeName, start, end, granularity))
+}
+
+// fetchBlocks fetches every block concurrently and delivers one response per
+// block, in completion order. The channel is closed once all are done.
+func (s *Service) fetchBlocks(ctx context.Context, provider ExchangeProvider, exchangeName, symbol string, granularity int64, blocks []candleBlock) <-chan CandleResponse {
+	responseChan := make(chan CandleResponse, len(blocks))
+	sem := make(chan struct{}, maxConcurrentRequests)
 	var wg sync.WaitGroup
 
-	for i, batchStart := range batchStarts {
+	for _, block := range blocks {
 		wg.Add(1)
-		go func(idx int, bStart int64) {
+		go func(b candleBlock) {
 			defer wg.Done()
-			sem <- struct{}{}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				responseChan <- CandleResponse{Index: b.Index, Error: ctx.Err()}
+				return
+			}
 			defer func() { <-sem }()
 
-			gridEnd := bStart + blockDuration
+			// Each block gets its own deadline once it is running, so one
+			// hanging upstream call cannot use up the time of the others
+			blockCtx, cancel := context.WithTimeout(ctx, s.BlockTimeout)
+			defer cancel()
 
-			reqEnd := gridEnd
-			if reqEnd > end {
-				reqEnd = end
+			candles, err := s.fetchBlock(blockCtx, provider, exchangeName, symbol, granularity, b)
+			// The shared call's own deadline can beat this one by a hair
+			if err != nil && ctx.Err() == nil && (blockCtx.Err() != nil || errors.Is(err, context.DeadlineExceeded)) {
+				err = fmt.Errorf("timed out after %s: %w", s.BlockTimeout, err)
 			}
+			responseChan <- CandleResponse{Data: candles, Index: b.Index, Error: err}
+		}(block)
+	}
 
-			isPartialBlock := reqEnd < gridEnd
+	go func() {
+		wg.Wait()
+		close(responseChan)
+	}()
 
-			if !isPartialBlock {
-				cachedCandles := s.GetFromCache(ctx, symbol, exchangeName, bStart, granularity)
-				if len(cachedCandles) > 0 {
-					responseChan <- CandleResponse{Data: cachedCandles, Index: idx, Error: nil}
-					return
-				}
-			}
+	return responseChan
+}
 
-			var candles []Candlestick
-			var err error
-
-			// Retry Logic
-			for attempt := range 3 {
-				candles, err = provider.FetchCandles(ctx, symbol, bStart, reqEnd, granularity)
-				if err == nil {
-					break
-				}
-
-				backoff := time.Duration(200*(1<<attempt)) * time.Millisecond
-				jitter := time.Duration(rand.Intn(50)) * time.Millisecond
-
-				select {
-				case <-ctx.Done():
-					responseChan <- CandleResponse{Index: idx, Error: ctx.Err()}
-					return
-				case <-time.After(backoff + jitter):
-					continue
-				}
-			}
+func (s *Service) fetchBlock(ctx context.Context, provider ExchangeProvider, exchangeName, symbol string, granularity int64, b candleBlock) ([]Candlestick, error) {
+	// Closed history never changes, so once upstream has settled a block it
+	// can be kept on disk indefinitely
+	caps := provider.Capabilities()
+	settled := s.Store != nil && !caps.Generated && blockSettled(b.GridEnd, granularity, time.Now().Unix())
+
+	// Handled like a partial block so it is neither cached nor stored
+	if caps.Volatile {
+		b.Partial, settled = true, false
+	}
 
-			if err == nil && !isPartialBlock && len(candles) > 0 {
-				s.SaveToCache(ctx, symbol, exchangeName, bStart, granularity, candles)
+	if !b.Partial {
+		cachedCandles := s.GetFromCache(ctx, symbol, exchangeName, b.Start, granularity)
+		if len(cachedCandles) > 0 {
+			return cachedCandles, nil
+		}
+
+		if settled {
+			if stored, ok := s.Store.Load(exchangeName, symbol, granularity, b.Start); ok {
+				s.SaveToCache(ctx, symbol, exchangeName, b.Start, granularity, stored)
+				return stored, nil
 			}
+		}
+	}
+
+	key := fmt.Sprintf("%s-%d", cacheKey(symbol, exchangeName, strconv.FormatInt(granularity, 10), b.Start), b.End)
+	return s.flight.do(ctx, key, s.BlockTimeout, func(ctx context.Context) ([]Candlestick, error) {
+		return s.fetchUpstream(ctx, provider, exchangeName, symbol, granularity, b, settled)
+	})
+}
+
+// fetchUpstream asks the provider for a block within its rate limit,
+// retrying failures that may go away, and files the result in the cache and
+// store.
+func (s *Service) fetchUpstream(ctx context.Context, provider ExchangeProvider, exchangeName, symbol string, granularity int64, b candleBlock, settled bool) ([]Candlestick, error) {
+	var candles []Candlestick
+	var err error
+	limiter := s.limiters[exchangeName]
+	breaker := s.breakers[exchangeName]
 
-			responseChan <- CandleResponse{Data: candles, Index: idx, Error: err}
-		}(i, batchStart)
+	// The breaker hears once per block, after the retries, so a single
+	// flaky block counts as one failure and a half open probe is one block
+	if err = breaker.Allow(); err != nil {
+		return nil, err
 	}
 
-	go func() {
-		wg.Wait()
-		close(responseChan)
-	}()
+	// Retry Logic
+	var called bool
+	var outcome error
+retry:
+	for attempt := range maxAttempts {
+		if err = limiter.Wait(ctx); err != nil {
+			break
+		}
+
+		candles, err = provider.FetchCandles(ctx, symbol, b.Start, b.End, granularity)
+		called, outcome = true, err
+		if err == nil || !IsRetryable(err) || attempt == maxAttempts-1 {
+			break
+		}
 
-	fullData, err := collectResponses(responseChan, len(batchStarts))
+		delay := retryDelay(err, attempt, time.Duration(rand.Intn(50))*time.Millisecond)
+		if errors.Is(err, ErrRateLimited) {
+			limiter.Pause(delay)
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break retry
+		case <-time.After(delay):
+		}
+	}
+	// Only upstream's own answers count, not time spent waiting on the
+	// limiter
+	if called {
+		breaker.Record(callOutcome(ctx, outcome))
+	}
 	if err != nil {
-		return []Candlestick{}, err
+		return nil, err
 	}
 
-	filteredData := make([]Candlestick, 0, len(fullData))
-	for _, c := range fullData {
-		if c.Timestamp >= start && c.Timestamp <= end {
-			filteredData = append(filteredData, c)
+	candles = cleanBlock(candles, b)
+
+	if !b.Partial && len(candles) > 0 {
+		s.SaveToCache(ctx, symbol, exchangeName, b.Start, granularity, candles)
+
+		if settled {
+			if err := s.Store.Save(exchangeName, symbol, granularity, b.Start, candles); err != nil {
+				log.Printf("Candle store save: %v", err)
+			}
 		}
 	}
 
-	return filteredData, nil
+	return candles, nil
+}
+
+// callOutcome tells the breaker why an upstream call ended. A call that ran
+// out of time, its own or every waiter's, counts against the provider. One
+// abandoned because its callers hung up says nothing and stays cancelled.
+func callOutcome(ctx context.Context, err error) error {
+	if ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return context.Cause(ctx)
+	}
+	return err
+}
+
+// cleanBlock sorts an upstream answer, keeps the last copy of any repeated
+// candle and drops those outside the block. Upstream ranges are inclusive,
+// so the candle starting the next block would otherwise appear twice.
+func cleanBlock(candles []Candlestick, b candleBlock) []Candlestick {
+	if len(candles) == 0 {
+		return candles
+	}
+
+	sorted := make([]Candlestick, len(candles))
+	copy(sorted, candles)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+
+	kept := sorted[:0]
+	for _, c := range sorted {
+		if c.Timestamp < b.Start || c.Timestamp >= b.GridEnd {
+			continue
+		}
+		if n := len(kept); n > 0 && kept[n-1].Timestamp == c.Timestamp {
+			kept[n-1] = c
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
 }
 
 func collectResponses(responseChan <-chan CandleResponse, expected int) ([]Candlestick, error) {
@@ -0,0 +1,87 @@
+package market
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit is the request budget a provider declares. A zero Rate means
+// the provider is not limited.
+type RateLimit struct {
+	Rate  float64 // requests per second
+	Burst int
+}
+
+// RateLimiter is a token bucket shared by every call to one provider. A
+// rate limited response pauses the whole bucket, not just the caller.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	paused time.Time
+}
+
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{limit: limit, tokens: float64(max(limit.Burst, 1)), last: time.Now()}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		delay := l.reserve(time.Now())
+		if delay <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise it reports how long
+// until one will be.
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.paused) {
+		return l.paused.Sub(now)
+	}
+	if l.limit.Rate <= 0 {
+		return 0
+	}
+
+	burst := float64(max(l.limit.Burst, 1))
+	l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.limit.Rate * float64(time.Second))
+}
+
+// Pause stops all requests for d, used when upstream says to back off.
+func (l *RateLimiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+		l.tokens = 0
+	}
+}
@@ -0,0 +1,62 @@
+package market
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBucket(t *testing.T) {
+	l := NewRateLimiter(RateLimit{Rate: 10, Burst: 3})
+	now := l.last
+
+	// The burst goes out at once, the next has to wait for a token
+	for i := range 3 {
+		if d := l.reserve(now); d != 0 {
+			t.Fatalf("request %d of the burst waits %v", i, d)
+		}
+	}
+	if d := l.reserve(now); d != 100*time.Millisecond {
+		t.Errorf("request past the burst waits %v, want 100ms", d)
+	}
+
+	// Tokens come back at Rate and never beyond Burst
+	if d := l.reserve(now.Add(100 * time.Millisecond)); d != 0 {
+		t.Errorf("waits %v after a token came back", d)
+	}
+	later := now.Add(time.Hour)
+	for i := range 3 {
+		if d := l.reserve(later); d != 0 {
+			t.Fatalf("request %d after a rest waits %v", i, d)
+		}
+	}
+	if d := l.reserve(later); d == 0 {
+		t.Error("bucket filled past its burst")
+	}
+
+	if d := NewRateLimiter(RateLimit{}).reserve(later); d != 0 {
+		t.Errorf("unlimited provider waits %v", d)
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	l := NewRateLimiter(RateLimit{})
+	l.Pause(50 * time.Millisecond)
+	// A shorter pause doesn't cut a longer one short
+	l.Pause(time.Millisecond)
+
+	began := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(began); waited < 40*time.Millisecond {
+		t.Errorf("waited %v through a 50ms pause", waited)
+	}
+
+	l.Pause(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Error("Wait outlasted its context")
+	}
+}
@@ -0,0 +1,196 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Timeframe is a chart bucket size. Fixed timeframes are Seconds long and
+// aligned Offset seconds after the epoch; calendar timeframes span Months.
+type Timeframe struct {
+	Label   string
+	Seconds int64
+	Offset  int64
+	Months  int
+}
+
+const (
+	day  = 86400
+	week = 7 * day
+	// The epoch fell on a Thursday, weeks start on the following Monday
+	mondayOffset = 4 * day
+)
+
+var Timeframes = map[string]Timeframe{
+	"1m":  {Label: "1m", Seconds: 60},
+	"3m":  {Label: "3m", Seconds: 180},
+	"5m":  {Label: "5m", Seconds: 300},
+	"15m": {Label: "15m", Seconds: 900},
+	"30m": {Label: "30m", Seconds: 1800},
+	"1H":  {Label: "1H", Seconds: 3600},
+	"2H":  {Label: "2H", Seconds: 7200},
+	"4H":  {Label: "4H", Seconds: 14400},
+	"6H":  {Label: "6H", Seconds: 21600},
+	"12H": {Label: "12H", Seconds: 43200},
+	"1D":  {Label: "1D", Seconds: day},
+	"1W":  {Label: "1W", Seconds: week, Offset: mondayOffset},
+	"1M":  {Label: "1M", Months: 1},
+}
+
+func ParseTimeframe(label string) (Timeframe, error) {
+	if tf, ok := Timeframes[label]; ok {
+		return tf, nil
+	}
+	return Timeframe{}, fmt.Errorf("unsupported timeframe %q", label)
+}
+
+// Fixed reports whether buckets are plain multiples of Seconds from the epoch.
+func (tf Timeframe) Fixed() bool {
+	return tf.Months == 0 && tf.Offset == 0
+}
+
+// Nominal is the typical bucket length, used for sizing ranges.
+func (tf Timeframe) Nominal() int64 {
+	if tf.Months > 0 {
+		return int64(tf.Months) * 31 * day
+	}
+	return tf.Seconds
+}
+
+func (tf Timeframe) BucketStart(ts int64) int64 {
+	if tf.Months > 0 {
+		t := time.Unix(ts, 0).UTC()
+		months := t.Year()*12 + int(t.Month()) - 1
+		months -= months % tf.Months
+		return time.Date(months/12, time.Month(months%12+1), 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	return floorDiv(ts-tf.Offset, tf.Seconds)*tf.Seconds + tf.Offset
+}
+
+func (tf Timeframe) NextBucket(bucket int64) int64 {
+	if tf.Months > 0 {
+		return time.Unix(bucket, 0).UTC().AddDate(0, tf.Months, 0).Unix()
+	}
+	return bucket + tf.Seconds
+}
+
+// resampleBlockBuckets is how many fixed length buckets make up a cache block
+// of resampled candles.
+const resampleBlockBuckets = 300
+
+// blockStart aligns ts to the cache block holding it: resampleBlockBuckets
+// buckets for fixed lengths, a calendar year for months.
+func (tf Timeframe) blockStart(ts int64) int64 {
+	if tf.Months > 0 {
+		return time.Date(time.Unix(ts, 0).UTC().Year(), time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	size := tf.Seconds * resampleBlockBuckets
+	return floorDiv(ts-tf.Offset, size)*size + tf.Offset
+}
+
+func (tf Timeframe) blockEnd(blockStart int64) int64 {
+	if tf.Months > 0 {
+		return time.Unix(blockStart, 0).UTC().AddDate(1, 0, 0).Unix()
+	}
+	return blockStart + tf.Seconds*resampleBlockBuckets
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// Resample folds sorted candles into tf buckets. Opens and closes come from
+// the first and last candle of a bucket and volume is summed.
+func Resample(candles []Candlestick, tf Timeframe) []Candlestick {
+	result := make([]Candlestick, 0, len(candles))
+
+	for _, c := range candles {
+		bucket := tf.BucketStart(c.Timestamp)
+		n := len(result)
+		if n == 0 || result[n-1].Timestamp != bucket {
+			result = append(result, Candlestick{
+				Timestamp: bucket,
+				Open:      c.Open,
+				High:      c.High,
+				Low:       c.Low,
+				Close:     c.Close,
+				Volume:    c.Volume,
+			})
+			continue
+		}
+
+		r := &result[n-1]
+		r.High = max(r.High, c.High)
+		r.Low = min(r.Low, c.Low)
+		r.Close = c.Close
+		r.Volume += c.Volume
+	}
+
+	return result
+}
+
+// FetchTimeframe returns candles for any supported timeframe, fetching
+// native candles directly and building the rest from the best native base.
+func (s *Service) FetchTimeframe(ctx context.Context, exchangeName, symbol string, start, end int64, tf Timeframe) ([]Candlestick, error) {
+	if s.isNative(exchangeName, tf) {
+		return s.FetchCandles(ctx, exchangeName, symbol, start, end, tf.Seconds)
+	}
+
+	var result []Candlestick
+	for block := tf.blockStart(start); block <= end; block = tf.blockEnd(block) {
+		candles, err := s.resampledBlock(ctx, exchangeName, symbol, block, end, tf)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, candles...)
+	}
+
+	first := tf.BucketStart(start)
+	filtered := make([]Candlestick, 0, len(result))
+	for _, c := range result {
+		if c.Timestamp >= first && c.Timestamp <= end {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+// resampledBlock builds one cache block of tf candles. Blocks that are over
+// are cached just like native blocks; the block still forming is rebuilt.
+func (s *Service) resampledBlock(ctx context.Context, exchangeName, symbol string, block, end int64, tf Timeframe) ([]Candlestick, error) {
+	blockEnd := tf.blockEnd(block)
+	complete := blockEnd <= end && blockEnd <= time.Now().Unix() && !s.capabilities(exchangeName).Volatile
+	key := cacheKey(symbol, exchangeName, tf.Label, block)
+
+	if complete {
+		if cached := s.getCached(key); len(cached) > 0 {
+			return cached, nil
+		}
+	}
+
+	base, err := s.baseGranularity(exchangeName, tf)
+	if err != nil {
+		return nil, err
+	}
+
+	candles, err := s.FetchCandles(ctx, exchangeName, symbol, block, min(blockEnd, end+1)-1, base)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Timestamp < candles[j].Timestamp
+	})
+	resampled := Resample(candles, tf)
+
+	if complete && len(resampled) > 0 {
+		s.putCached(key, resampled, blockEnd, base)
+	}
+	return resampled, nil
+}
@@ -0,0 +1,162 @@
+package market
+
+import (
+	"testing"
+	"time"
+)
+
+func utc(year int, month time.Month, day, hour, min int) int64 {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC).Unix()
+}
+
+func TestBucketStart(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		tf    string
+		ts    int64
+		start int64
+		next  int64
+	}{
+		{"minute", "1m", utc(2024, 6, 1, 12, 0) + 59, utc(2024, 6, 1, 12, 0), utc(2024, 6, 1, 12, 1)},
+		{"three minutes", "3m", utc(2024, 6, 1, 12, 5), utc(2024, 6, 1, 12, 3), utc(2024, 6, 1, 12, 6)},
+		{"four hours", "4H", utc(2024, 6, 1, 15, 30), utc(2024, 6, 1, 12, 0), utc(2024, 6, 1, 16, 0)},
+		{"twelve hours", "12H", utc(2024, 6, 1, 11, 59), utc(2024, 6, 1, 0, 0), utc(2024, 6, 1, 12, 0)},
+		{"day", "1D", utc(2024, 6, 1, 23, 59), utc(2024, 6, 1, 0, 0), utc(2024, 6, 2, 0, 0)},
+		{"before the epoch", "1H", -1, -3600, 0},
+
+		// Buckets are UTC, a local clock change does not move them. US
+		// clocks sprang forward 2024-03-10 07:00 UTC and Europe's fell back
+		// 2024-10-27 01:00 UTC.
+		{"day over spring forward", "1D", utc(2024, 3, 10, 7, 30), utc(2024, 3, 10, 0, 0), utc(2024, 3, 11, 0, 0)},
+		{"day over fall back", "1D", utc(2024, 10, 27, 1, 30), utc(2024, 10, 27, 0, 0), utc(2024, 10, 28, 0, 0)},
+		{"hour over fall back", "1H", utc(2024, 10, 27, 1, 30), utc(2024, 10, 27, 1, 0), utc(2024, 10, 27, 2, 0)},
+
+		// Weeks start on Monday
+		{"week on monday", "1W", utc(2024, 6, 3, 0, 0), utc(2024, 6, 3, 0, 0), utc(2024, 6, 10, 0, 0)},
+		{"week on sunday", "1W", utc(2024, 6, 9, 23, 59), utc(2024, 6, 3, 0, 0), utc(2024, 6, 10, 0, 0)},
+		{"week over the new year", "1W", utc(2025, 1, 1, 12, 0), utc(2024, 12, 30, 0, 0), utc(2025, 1, 6, 0, 0)},
+		{"week of the epoch", "1W", 0, utc(1969, 12, 29, 0, 0), utc(1970, 1, 5, 0, 0)},
+		{"week over spring forward", "1W", utc(2024, 3, 10, 12, 0), utc(2024, 3, 4, 0, 0), utc(2024, 3, 11, 0, 0)},
+
+		// Months run from the 1st whatever their length
+		{"month of 31 days", "1M", utc(2024, 1, 31, 23, 59), utc(2024, 1, 1, 0, 0), utc(2024, 2, 1, 0, 0)},
+		{"leap february", "1M", utc(2024, 2, 29, 12, 0), utc(2024, 2, 1, 0, 0), utc(2024, 3, 1, 0, 0)},
+		{"february", "1M", utc(2023, 2, 28, 12, 0), utc(2023, 2, 1, 0, 0), utc(2023, 3, 1, 0, 0)},
+		{"month of 30 days", "1M", utc(2024, 4, 30, 23, 59), utc(2024, 4, 1, 0, 0), utc(2024, 5, 1, 0, 0)},
+		{"december", "1M", utc(2024, 12, 15, 0, 0), utc(2024, 12, 1, 0, 0), utc(2025, 1, 1, 0, 0)},
+		{"month over fall back", "1M", utc(2024, 10, 31, 0, 0), utc(2024, 10, 1, 0, 0), utc(2024, 11, 1, 0, 0)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tf := Timeframes[tc.tf]
+			if got := tf.BucketStart(tc.ts); got != tc.start {
+				t.Errorf("BucketStart = %s, want %s", time.Unix(got, 0).UTC(), time.Unix(tc.start, 0).UTC())
+			}
+			if got := tf.NextBucket(tc.start); got != tc.next {
+				t.Errorf("NextBucket = %s, want %s", time.Unix(got, 0).UTC(), time.Unix(tc.next, 0).UTC())
+			}
+		})
+	}
+}
+
+func TestBlockAlignment(t *testing.T) {
+	month := Timeframes["1M"]
+	if got := month.blockStart(utc(2024, 7, 4, 0, 0)); got != utc(2024, 1, 1, 0, 0) {
+		t.Errorf("month block starts %s, want the start of the year", time.Unix(got, 0).UTC())
+	}
+	if got := month.blockEnd(utc(2024, 1, 1, 0, 0)); got != utc(2025, 1, 1, 0, 0) {
+		t.Errorf("month block ends %s, want the next year", time.Unix(got, 0).UTC())
+	}
+
+	// A week block starts on a Monday like its buckets
+	week := Timeframes["1W"]
+	start := week.blockStart(utc(2024, 6, 5, 0, 0))
+	if time.Unix(start, 0).UTC().Weekday() != time.Monday || week.BucketStart(start) != start {
+		t.Errorf("week block starts %s, not on a bucket", time.Unix(start, 0).UTC())
+	}
+}
+
+func TestResample(t *testing.T) {
+	c := func(ts int64, open, high, low, close, volume float64) Candlestick {
+		return Candlestick{Timestamp: ts, Open: open, High: high, Low: low, Close: close, Volume: volume}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		tf      string
+		candles []Candlestick
+		want    []Candlestick
+	}{
+		{
+			name: "minutes into five",
+			tf:   "5m",
+			candles: []Candlestick{
+				c(0, 10, 11, 9, 10.5, 1),
+				c(60, 10.5, 13, 10, 12, 2),
+				c(240, 12, 12, 8, 9, 3),
+				c(300, 9, 9.5, 8.5, 9.2, 4),
+			},
+			want: []Candlestick{
+				c(0, 10, 13, 8, 9, 6),
+				c(300, 9, 9.5, 8.5, 9.2, 4),
+			},
+		},
+		{
+			name: "missing buckets stay missing",
+			tf:   "1H",
+			candles: []Candlestick{
+				c(0, 1, 1, 1, 1, 1),
+				c(3*3600, 2, 2, 2, 2, 1),
+			},
+			want: []Candlestick{
+				c(0, 1, 1, 1, 1, 1),
+				c(3*3600, 2, 2, 2, 2, 1),
+			},
+		},
+		{
+			name: "days into a week split on monday",
+			tf:   "1W",
+			candles: []Candlestick{
+				c(utc(2024, 6, 8, 0, 0), 1, 2, 1, 2, 1),
+				c(utc(2024, 6, 9, 0, 0), 2, 3, 2, 3, 1),
+				c(utc(2024, 6, 10, 0, 0), 3, 4, 1, 1, 1),
+			},
+			want: []Candlestick{
+				c(utc(2024, 6, 3, 0, 0), 1, 3, 1, 3, 2),
+				c(utc(2024, 6, 10, 0, 0), 3, 4, 1, 1, 1),
+			},
+		},
+		{
+			name: "days into months of different lengths",
+			tf:   "1M",
+			candles: []Candlestick{
+				c(utc(2024, 1, 31, 0, 0), 1, 1, 1, 1, 1),
+				c(utc(2024, 2, 1, 0, 0), 2, 5, 2, 4, 1),
+				c(utc(2024, 2, 29, 0, 0), 4, 4, 0.5, 3, 2),
+				c(utc(2024, 3, 1, 0, 0), 3, 3, 3, 3, 1),
+			},
+			want: []Candlestick{
+				c(utc(2024, 1, 1, 0, 0), 1, 1, 1, 1, 1),
+				c(utc(2024, 2, 1, 0, 0), 2, 5, 0.5, 3, 3),
+				c(utc(2024, 3, 1, 0, 0), 3, 3, 3, 3, 1),
+			},
+		},
+		{
+			name:    "nothing",
+			tf:      "1D",
+			candles: nil,
+			want:    nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Resample(tc.candles, Timeframes[tc.tf])
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+			for i := range tc.want {
+				if got[i] != tc.want[i] {
+					t.Errorf("candle %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
@@ -1,68 +1,406 @@
 package market
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// refreshRetry is how soon a refresh is tried again after a provider
+// failed, when the regular interval is longer.
+const refreshRetry = time.Minute
+
+// maxListingChanges bounds how many listing changes are remembered.
+const maxListingChanges = 500
+
 type Engine struct {
-	mu    sync.Mutex
-	index []Product
+	Registry  *Registry
+	Providers map[string]ExchangeProvider
+	// Popularity, when set, lifts often viewed markets in results
+	Popularity *Popularity
+
+	// index is swapped whole on every rebuild, searches never wait on one
+	index atomic.Pointer[[]searchEntry]
+
+	// build serialises rebuilds, mu guards the bookkeeping below
+	build    sync.Mutex
+	mu       sync.RWMutex
+	listings map[string]*providerListing
+	changes  []ListingChange
+	builtAt  time.Time
+}
+
+// providerListing is the last good product list of one provider and how
+// its most recent fetch went.
+type providerListing struct {
+	products  []Product
+	updatedAt time.Time
+	failedAt  time.Time
+	err       error
+}
+
+// ListingChange records a market appearing in or vanishing from a
+// provider's product list between two rebuilds.
+type ListingChange struct {
+	Market Market `json:"market"`
+	// Change is "listed" or "delisted"
+	Change string `json:"change"`
+	At     int64  `json:"at"`
+}
+
+// IndexHealth describes the search index. Healthy means every provider's
+// products came from its latest fetch.
+type IndexHealth struct {
+	Healthy   bool                           `json:"healthy"`
+	BuiltAt   int64                          `json:"builtAt"`
+	Products  int                            `json:"products"`
+	Providers map[string]ProviderIndexHealth `json:"providers"`
+	Changes   []ListingChange                `json:"changes"`
+}
+
+type ProviderIndexHealth struct {
+	Products  int    `json:"products"`
+	UpdatedAt int64  `json:"updatedAt,omitempty"`
+	FailedAt  int64  `json:"failedAt,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Stale is set while the last good products stand in for a failed
+	// fetch
+	Stale bool `json:"stale"`
 }
 
-func NewEngine(providers map[string]ExchangeProvider) *Engine {
+// NewEngine indexes every provider's products, recording them in registry
+// as well. A nil registry gets a fresh one.
+func NewEngine(providers map[string]ExchangeProvider, registry *Registry) *Engine {
+	if registry == nil {
+		registry = NewRegistry()
+	}
 	e := &Engine{
-		index: make([]Product, 0),
+		Registry:  registry,
+		Providers: providers,
+		listings:  make(map[string]*providerListing),
+	}
+	e.index.Store(&[]searchEntry{})
+	if err := e.Update(); err != nil {
+		log.Printf("Search index: %v", err)
 	}
-	e.BuildIndex(providers)
 	return e
 }
 
-func (e *Engine) BuildIndex(providers map[string]ExchangeProvider) {
+// Update fetches every provider's products and swaps in a new index. A
+// provider that fails keeps its last good products, and the failures are
+// returned together.
+func (e *Engine) Update() error {
+	e.build.Lock()
+	defer e.build.Unlock()
+	return e.update()
+}
+
+// Refresh rebuilds the index unless it was built within maxAge. Callers
+// arriving during a rebuild wait for it and share its result instead of
+// starting another; rebuilt reports whether this call did the work.
+func (e *Engine) Refresh(maxAge time.Duration) (rebuilt bool, err error) {
+	e.build.Lock()
+	defer e.build.Unlock()
+
+	e.mu.RLock()
+	fresh := time.Since(e.builtAt) < maxAge
+	e.mu.RUnlock()
+	if fresh {
+		return false, nil
+	}
+	return true, e.update()
+}
+
+// update does the work of Update, with build held.
+func (e *Engine) update() error {
+	type fetched struct {
+		name     string
+		products []Product
+		err      error
+	}
+	results := make(chan fetched, len(e.Providers))
+	var wg sync.WaitGroup
+	for name, p := range e.Providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			products, err := p.GetProducts()
+			results <- fetched{name, products, err}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	now := time.Now()
+	var errs []error
+
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	for r := range results {
+		l, ok := e.listings[r.name]
+		if !ok {
+			l = &providerListing{}
+			e.listings[r.name] = l
+		}
 
-	var agg []Product
-	for _, p := range providers {
-		products, err := p.GetProducts()
-		if err != nil {
+		// An empty answer from a provider that listed products is more
+		// likely an upstream fault than every market closing at once
+		if r.err == nil && len(r.products) == 0 && len(l.products) > 0 {
+			r.err = errors.New("returned no products")
+		}
+		if r.err != nil {
+			l.err, l.failedAt = r.err, now
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, r.err))
 			continue
 		}
-		agg = append(agg, products...)
+
+		if !l.updatedAt.IsZero() {
+			e.recordChanges(r.name, l.products, r.products, now)
+		}
+		e.Registry.Update(r.name, r.products)
+		l.products, l.updatedAt, l.err = r.products, now, nil
 	}
 
-	sort.Slice(agg, func(i, j int) bool {
-		return agg[i].Name < agg[j].Name
-	})
+	var index []searchEntry
+	for _, l := range e.listings {
+		for _, p := range l.products {
+			index = append(index, newSearchEntry(p))
+		}
+	}
+	bases := baseRanking(index)
+	for i := range index {
+		index[i].baseBonus = rankBonus(bases, strings.ToUpper(index[i].Base), bonusMajorBase)
+	}
+	e.index.Store(&index)
+	e.builtAt = now
+	e.mu.Unlock()
 
-	e.index = agg
+	return errors.Join(errs...)
 }
 
-func (e *Engine) Search(query string, limit int) []Product {
-	query = strings.ToUpper(query)
+// recordChanges notes which markets of exchange came and went.
+func (e *Engine) recordChanges(exchange string, before, after []Product, now time.Time) {
+	was := make(map[string]bool, len(before))
+	for _, p := range before {
+		was[p.ID] = true
+	}
+	is := make(map[string]bool, len(after))
+	for _, p := range after {
+		is[p.ID] = true
+	}
+
+	var listed, delisted []string
+	for id := range is {
+		if !was[id] {
+			listed = append(listed, id)
+		}
+	}
+	for id := range was {
+		if !is[id] {
+			delisted = append(delisted, id)
+		}
+	}
+	if len(listed) == 0 && len(delisted) == 0 {
+		return
+	}
+	sort.Strings(listed)
+	sort.Strings(delisted)
+	log.Printf("Search index: %s listed %v, delisted %v", exchange, listed, delisted)
+
+	for _, id := range listed {
+		e.changes = append(e.changes, ListingChange{Market{exchange, id}, "listed", now.Unix()})
+	}
+	for _, id := range delisted {
+		e.changes = append(e.changes, ListingChange{Market{exchange, id}, "delisted", now.Unix()})
+	}
+	if n := len(e.changes) - maxListingChanges; n > 0 {
+		e.changes = append([]ListingChange(nil), e.changes[n:]...)
+	}
+}
+
+// StartRefresher rebuilds the index every interval until ctx is done,
+// retrying sooner while a provider is failing.
+func (e *Engine) StartRefresher(ctx context.Context, interval time.Duration) {
+	go func() {
+		wait := interval
+		if !e.Health().Healthy {
+			wait = min(interval, refreshRetry)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+
+			wait = interval
+			if err := e.Update(); err != nil {
+				log.Printf("Search index refresh: %v", err)
+				wait = min(interval, refreshRetry)
+			}
+		}
+	}()
+}
+
+// Health reports how current the index is for each provider.
+func (e *Engine) Health() IndexHealth {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	h := IndexHealth{
+		Healthy:   len(e.listings) == len(e.Providers),
+		BuiltAt:   e.builtAt.Unix(),
+		Products:  len(*e.index.Load()),
+		Providers: make(map[string]ProviderIndexHealth, len(e.listings)),
+		Changes:   append([]ListingChange{}, e.changes...),
+	}
+	for name, l := range e.listings {
+		p := ProviderIndexHealth{Products: len(l.products), Stale: l.err != nil}
+		if !l.updatedAt.IsZero() {
+			p.UpdatedAt = l.updatedAt.Unix()
+		}
+		if l.err != nil {
+			p.FailedAt = l.failedAt.Unix()
+			p.Error = l.err.Error()
+			h.Healthy = false
+		}
+		h.Providers[name] = p
+	}
+	return h
+}
 
-	if query == "" {
+// Search ranks products against a free form query. Terms may come in any
+// order and with any separators, so "eth usd", "ETH-USD", "usd eth" and
+// "ethereum" all find ETH/USD markets. Full asset names and small typos are
+// understood, and exact base matches, major quotes and heavily traded
+// assets rank first.
+func (e *Engine) Search(query string, limit int) []Product {
+	if len(searchTerms(query)) == 0 {
 		return []Product{}
 	}
+	return e.Query(query, SearchFilter{}, 0, limit).Results
+}
 
-	idx := sort.Search(len(e.index), func(i int) bool {
-		return e.index[i].Name >= query
-	})
+// SearchPage is one page of search results. Total counts every match, and
+// NextCursor is set while more pages follow.
+type SearchPage struct {
+	Results    []Product `json:"results"`
+	Total      int       `json:"total"`
+	Offset     int       `json:"offset"`
+	Limit      int       `json:"limit"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
 
-	results := make([]Product, 0, limit)
-	for i := idx; i < len(e.index) && len(results) < limit; i++ {
-		if !strings.HasPrefix(e.index[i].Name, query) {
-			break
+// Query ranks the products passing filter against query and returns limit
+// of them from offset on. An empty query lists everything passing filter,
+// most traded first.
+func (e *Engine) Query(query string, filter SearchFilter, offset, limit int) SearchPage {
+	ranked := rankEntries(*e.index.Load(), query, filter, e.Popularity.Scores())
+
+	offset = max(offset, 0)
+	page := SearchPage{
+		Results: make([]Product, 0, max(min(limit, len(ranked)-offset), 0)),
+		Total:   len(ranked),
+		Offset:  offset,
+		Limit:   limit,
+	}
+	for i := offset; i < len(ranked) && len(page.Results) < limit; i++ {
+		page.Results = append(page.Results, ranked[i].entry.Product)
+	}
+	if next := offset + len(page.Results); next < len(ranked) && len(page.Results) > 0 {
+		page.NextCursor = EncodeSearchCursor(next)
+	}
+	return page
+}
+
+// EncodeSearchCursor makes the opaque cursor for the page at offset.
+// Cursors are positions in the ranking, so a rebuild of the index between
+// pages may shift results by a few places.
+func EncodeSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+// DecodeSearchCursor reads a cursor made by EncodeSearchCursor.
+func DecodeSearchCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		if s, ok := strings.CutPrefix(string(raw), "o:"); ok {
+			if offset, err := strconv.Atoi(s); err == nil && offset >= 0 {
+				return offset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid cursor %q", cursor)
+}
+
+// Suggestions are what to offer before anything is typed.
+type Suggestions struct {
+	// Trending are the markets most viewed in the last hours
+	Trending []Product `json:"trending"`
+	// Popular are the most viewed markets over weeks, topped up with the
+	// most traded ones while views are scarce
+	Popular []Product `json:"popular"`
+}
+
+// Suggest returns up to limit trending and popular products. Markets no
+// longer listed are left out.
+func (e *Engine) Suggest(limit int) Suggestions {
+	index := *e.index.Load()
+	listed := make(map[Market]Product, len(index))
+	for _, p := range index {
+		listed[Market{Exchange: p.Exchange, Symbol: p.ID}] = p.Product
+	}
+	scores := e.Popularity.Scores()
+
+	pick := func(floor float64, by func(MarketScore) float64) []Product {
+		products := make([]Product, 0, limit)
+		for _, s := range topMarkets(scores, floor, by) {
+			if len(products) >= limit {
+				break
+			}
+			if p, ok := listed[s.Market]; ok {
+				products = append(products, p)
+			}
 		}
-		results = append(results, e.index[i])
-		if len(results) >= limit {
+		return products
+	}
+
+	s := Suggestions{
+		Trending: pick(minTrending, func(s MarketScore) float64 { return s.Trending }),
+		Popular:  pick(minPopularity, func(s MarketScore) float64 { return s.Popular }),
+	}
+
+	taken := make(map[Market]bool, len(s.Popular))
+	for _, p := range s.Popular {
+		taken[Market{Exchange: p.Exchange, Symbol: p.ID}] = true
+	}
+	for _, r := range rankEntries(index, "", SearchFilter{}, scores) {
+		if len(s.Popular) >= limit {
 			break
 		}
+		if m := (Market{Exchange: r.entry.Exchange, Symbol: r.entry.ID}); !taken[m] {
+			s.Popular = append(s.Popular, r.entry.Product)
+		}
 	}
-	return results
+	return s
 }
 
-func (e *Engine) Update() error {
-	return nil
+// Product looks up a listed product by exchange and id. Canonical symbols
+// are accepted for the id as well.
+func (e *Engine) Product(exchange, id string) (Product, bool) {
+	id = e.Registry.Resolve(exchange, id)
+
+	for _, p := range *e.index.Load() {
+		if p.Exchange == exchange && p.ID == id {
+			return p.Product, true
+		}
+	}
+	return Product{}, false
 }
@@ -0,0 +1,412 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// listingProvider serves a fixed product list, or err when set, and
+// nothing else.
+type listingProvider struct {
+	products []Product
+	err      error
+}
+
+func (p *listingProvider) ID() string { return "listing" }
+
+func (p *listingProvider) GetProducts() ([]Product, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return append([]Product(nil), p.products...), nil
+}
+
+func (p *listingProvider) RateLimit() RateLimit { return RateLimit{} }
+
+func (p *listingProvider) Capabilities() Capabilities { return Capabilities{} }
+
+func (p *listingProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	return nil, nil
+}
+
+func listing(exchange, sep string, status string, pairs ...string) *listingProvider {
+	p := &listingProvider{}
+	for _, pair := range pairs {
+		base, quote, _ := strings.Cut(pair, "/")
+		p.products = append(p.products, Product{
+			ID:       base + sep + quote,
+			Name:     base + quote,
+			Type:     "crypto",
+			Exchange: exchange,
+			Base:     base,
+			Quote:    quote,
+			Status:   status,
+		})
+	}
+	return p
+}
+
+func newRelevanceEngine() *Engine {
+	halted := listing("binance", "/", StatusHalted, "LUNA/USDT")
+	online := listing("binance", "/", StatusOnline,
+		"BTC/USDT", "BTC/USDC", "ETH/USDT", "ETH/BTC", "SOL/USDT", "SOLV/USDT", "DOGE/USDT", "BCH/USDT", "ETC/USDT", "USDC/USDT")
+	online.products = append(online.products, halted.products...)
+
+	return NewEngine(map[string]ExchangeProvider{
+		"coinbase": listing("coinbase", "-", StatusOnline,
+			"BTC/USD", "BTC/EUR", "ETH/USD", "ETH/EUR", "ETH/BTC", "SOL/USD", "BCH/USD", "LUNA/USD", "DOGE/USD", "SHIB/USD", "USDT/USD"),
+		"binance": online,
+		"kraken":  listing("kraken", "/", StatusOnline, "BTC/USD", "ETH/USD", "DOGE/USD", "XMR/USD", "ETC/USD"),
+		"simulated": &listingProvider{products: []Product{
+			{ID: "SIM-BTC", Name: "SIM-BTC", Type: "simulated", Exchange: "simulated", Status: StatusOnline},
+		}},
+	}, nil)
+}
+
+// pairsOf lists the BASE/QUOTE of each result in order, once each, so the
+// same market on several exchanges counts once.
+func pairsOf(products []Product) []string {
+	seen := make(map[string]bool)
+	var pairs []string
+	for _, p := range products {
+		pair := p.Base + "/" + p.Quote
+		if p.Base == "" {
+			pair = p.ID
+		}
+		if !seen[pair] {
+			seen[pair] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+func TestSearchRelevance(t *testing.T) {
+	engine := newRelevanceEngine()
+
+	tests := []struct {
+		name  string
+		query string
+		// want are the leading distinct pairs, in order
+		want []string
+	}{
+		{"ticker ranks major quotes first", "btc", []string{"BTC/USD", "BTC/USDT", "BTC/USDC", "BTC/EUR"}},
+		{"space separated", "eth usd", []string{"ETH/USD"}},
+		{"dash separated", "ETH-USD", []string{"ETH/USD"}},
+		{"slash separated", "eth/usd", []string{"ETH/USD"}},
+		{"reversed terms", "usd eth", []string{"ETH/USD"}},
+		{"no separator", "ethusd", []string{"ETH/USD"}},
+		{"partial pair", "ethu", []string{"ETH/USD", "ETH/USDT"}},
+		{"full name", "ethereum", []string{"ETH/USD", "ETH/USDT", "ETH/EUR", "ETH/BTC"}},
+		{"full name with typo", "etherium", []string{"ETH/USD"}},
+		{"typo in bitcoin", "bitcon", []string{"BTC/USD"}},
+		{"multi word name", "bitcoin cash", []string{"BCH/USD", "BCH/USDT"}},
+		{"legacy ticker", "xbt", []string{"BTC/USD"}},
+		{"exact base before longer base", "sol", []string{"SOL/USD", "SOL/USDT", "SOLV/USDT"}},
+		{"cross pair", "eth btc", []string{"ETH/BTC"}},
+		{"fiat name", "bitcoin euro", []string{"BTC/EUR"}},
+		{"halted ranks last", "luna", []string{"LUNA/USD", "LUNA/USDT"}},
+		{"lesser known asset", "monero", []string{"XMR/USD"}},
+		{"product without a pair", "sim btc", []string{"SIM-BTC"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pairsOf(engine.Search(tt.query, 50))
+			if len(got) < len(tt.want) {
+				t.Fatalf("Search(%q) = %v, want %v first", tt.query, got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Search(%q) = %v, want %v first", tt.query, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchQuotedMarketsFollowBaseMatches(t *testing.T) {
+	engine := newRelevanceEngine()
+
+	got := pairsOf(engine.Search("btc", 50))
+	for i, pair := range got {
+		if strings.HasSuffix(pair, "/BTC") {
+			for _, later := range got[i:] {
+				if strings.HasPrefix(later, "BTC/") {
+					t.Fatalf("BTC base market %s ranked after %s: %v", later, pair, got)
+				}
+			}
+			return
+		}
+	}
+	t.Fatalf("ETH/BTC missing from %v", got)
+}
+
+func TestSearchRanksByReportedVolume(t *testing.T) {
+	search := func(p *listingProvider) []string {
+		return pairsOf(NewEngine(map[string]ExchangeProvider{"coinbase": p}, nil).Search("usd", 10))
+	}
+
+	// Without any volume the usual majors lead
+	if got := search(listing("coinbase", "-", StatusOnline, "BTC/USD", "PEPE/USD", "BTC/EUR")); got[0] != "BTC/USD" {
+		t.Errorf("without volume got %v, want BTC/USD first", got)
+	}
+
+	// Volume in a quote that isn't dollars isn't added up
+	busy := listing("coinbase", "-", StatusOnline, "BTC/USD", "PEPE/USD", "BTC/EUR")
+	busy.products[0].Volume24h = 1e6
+	busy.products[1].Volume24h = 5e8
+	busy.products[2].Volume24h = 1e12
+	if got := search(busy); got[0] != "PEPE/USD" {
+		t.Errorf("with volume got %v, want PEPE/USD first", got)
+	}
+}
+
+func TestSearchRejectsUnrelated(t *testing.T) {
+	engine := newRelevanceEngine()
+
+	for _, query := range []string{"", "  ", "zzz", "eth zzz", "bt"} {
+		got := engine.Search(query, 50)
+		if query == "bt" {
+			// A prefix is fine, a two letter typo is not
+			for _, p := range got {
+				if !strings.Contains(" "+strings.Join(searchTerms(p.ID), " "), " BT") {
+					t.Errorf("Search(%q) matched %+v", query, p)
+				}
+			}
+			continue
+		}
+		if len(got) != 0 {
+			t.Errorf("Search(%q) = %v, want nothing", query, pairsOf(got))
+		}
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	engine := newRelevanceEngine()
+
+	if got := engine.Search("usd", 3); len(got) != 3 {
+		t.Errorf("Search(usd, 3) returned %d products", len(got))
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"BITCOIN", "BITCOIN", 0},
+		{"BITCON", "BITCOIN", 1},
+		{"BTICOIN", "BITCOIN", 1},
+		{"ETHERIUM", "ETHEREUM", 1},
+		{"", "ETH", 3},
+		{"SOLANA", "SOLAAN", 1},
+	} {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateKeepsLastGoodProducts(t *testing.T) {
+	coinbase := listing("coinbase", "-", StatusOnline, "BTC/USD", "ETH/USD")
+	engine := NewEngine(map[string]ExchangeProvider{"coinbase": coinbase}, nil)
+
+	coinbase.err = errors.New("503 Service Unavailable")
+	if err := engine.Update(); err == nil {
+		t.Fatal("Update hid the provider failure")
+	}
+	if got := engine.Search("btc", 10); len(got) != 1 {
+		t.Fatalf("search lost products after a failed refresh: %+v", got)
+	}
+	if _, ok := engine.Registry.Instrument("BTC/USD"); !ok {
+		t.Error("registry lost BTC/USD after a failed refresh")
+	}
+
+	h := engine.Health()
+	if h.Healthy || !h.Providers["coinbase"].Stale || h.Providers["coinbase"].Products != 2 {
+		t.Errorf("health after failure = %+v", h)
+	}
+
+	// Nothing listed at all is treated as a failure too
+	coinbase.err, coinbase.products = nil, nil
+	if err := engine.Update(); err == nil {
+		t.Error("empty product list replaced the index")
+	}
+	if got := engine.Search("eth", 10); len(got) != 1 {
+		t.Errorf("search lost products after an empty refresh: %+v", got)
+	}
+}
+
+func TestUpdateRecoversFromFailedStart(t *testing.T) {
+	coinbase := listing("coinbase", "-", StatusOnline, "BTC/USD")
+	coinbase.err = errors.New("connection refused")
+	engine := NewEngine(map[string]ExchangeProvider{"coinbase": coinbase}, nil)
+
+	if got := engine.Search("btc", 10); len(got) != 0 {
+		t.Fatalf("search without products = %+v", got)
+	}
+	if engine.Health().Healthy {
+		t.Error("index healthy without products")
+	}
+
+	coinbase.err = nil
+	if err := engine.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got := engine.Search("btc", 10); len(got) != 1 {
+		t.Errorf("search after recovery = %+v", got)
+	}
+	if h := engine.Health(); !h.Healthy || len(h.Changes) != 0 {
+		t.Errorf("health after recovery = %+v", h)
+	}
+}
+
+func TestUpdateTracksListingChanges(t *testing.T) {
+	coinbase := listing("coinbase", "-", StatusOnline, "BTC/USD", "LUNA/USD")
+	engine := NewEngine(map[string]ExchangeProvider{"coinbase": coinbase}, nil)
+
+	coinbase.products = listing("coinbase", "-", StatusOnline, "BTC/USD", "SOL/USD").products
+	if err := engine.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[ListingChange]bool{}
+	for _, c := range engine.Health().Changes {
+		c.At = 0
+		want[c] = true
+	}
+	if len(want) != 2 ||
+		!want[ListingChange{Market: Market{"coinbase", "SOL-USD"}, Change: "listed"}] ||
+		!want[ListingChange{Market: Market{"coinbase", "LUNA-USD"}, Change: "delisted"}] {
+		t.Errorf("changes = %+v", engine.Health().Changes)
+	}
+
+	if _, ok := engine.Product("coinbase", "LUNA-USD"); ok {
+		t.Error("delisted product still listed")
+	}
+	if _, ok := engine.Registry.Instrument("SOL/USD"); !ok {
+		t.Error("new listing missing from registry")
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	engine := newRelevanceEngine()
+
+	page := engine.Query("", SearchFilter{Exchanges: []string{"coinbase"}, Quotes: []string{"usd"}}, 0, 100)
+	if page.Total != 8 || len(page.Results) != 8 {
+		t.Fatalf("USD markets on coinbase: total %d, got %v", page.Total, pairsOf(page.Results))
+	}
+	for _, p := range page.Results {
+		if p.Exchange != "coinbase" || p.Quote != "USD" {
+			t.Errorf("filtered result %+v", p)
+		}
+	}
+	if page.Results[0].ID != "BTC-USD" {
+		t.Errorf("browsing starts with %s, want BTC-USD", page.Results[0].ID)
+	}
+
+	page = engine.Query("luna", SearchFilter{Statuses: []string{StatusHalted}}, 0, 10)
+	if page.Total != 1 || page.Results[0].ID != "LUNA/USDT" {
+		t.Errorf("halted luna = %+v", page)
+	}
+
+	page = engine.Query("btc", SearchFilter{Exchanges: []string{"binance", "kraken"}, Types: []string{"crypto"}}, 0, 10)
+	for _, p := range page.Results {
+		if p.Exchange == "coinbase" {
+			t.Errorf("coinbase result with exchange filter: %+v", p)
+		}
+	}
+}
+
+func TestQueryPages(t *testing.T) {
+	engine := newRelevanceEngine()
+	filter := SearchFilter{Exchanges: []string{"binance"}}
+
+	all := engine.Query("", filter, 0, 100)
+	if all.Total != 11 || all.NextCursor != "" {
+		t.Fatalf("all binance = total %d, cursor %q", all.Total, all.NextCursor)
+	}
+
+	var paged []Product
+	offset := 0
+	for pages := 0; ; pages++ {
+		if pages > all.Total {
+			t.Fatal("paging does not end")
+		}
+		page := engine.Query("", filter, offset, 4)
+		if page.Total != all.Total {
+			t.Fatalf("page total %d, want %d", page.Total, all.Total)
+		}
+		paged = append(paged, page.Results...)
+		if page.NextCursor == "" {
+			break
+		}
+		next, err := DecodeSearchCursor(page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset = next
+	}
+
+	if len(paged) != len(all.Results) {
+		t.Fatalf("paged %d products, want %d", len(paged), len(all.Results))
+	}
+	for i := range paged {
+		if paged[i] != all.Results[i] {
+			t.Errorf("page result %d = %s, want %s", i, paged[i].ID, all.Results[i].ID)
+		}
+	}
+
+	if page := engine.Query("", filter, 50, 4); len(page.Results) != 0 || page.Total != all.Total {
+		t.Errorf("offset past the end = %+v", page)
+	}
+	if _, err := DecodeSearchCursor("bogus"); err == nil {
+		t.Error("bogus cursor accepted")
+	}
+}
+
+// slowListing counts product fetches, each taking a while.
+type slowListing struct {
+	*listingProvider
+	calls atomic.Int32
+}
+
+func (p *slowListing) GetProducts() ([]Product, error) {
+	p.calls.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return p.listingProvider.GetProducts()
+}
+
+func TestRefreshSharesOneRebuild(t *testing.T) {
+	provider := &slowListing{listingProvider: listing("coinbase", "-", StatusOnline, "BTC/USD")}
+	e := NewEngine(map[string]ExchangeProvider{"coinbase": provider}, nil)
+
+	// Just built
+	if rebuilt, err := e.Refresh(time.Minute); rebuilt || err != nil {
+		t.Fatalf("fresh index rebuilt: %v %v", rebuilt, err)
+	}
+
+	// Stale: eight callers at once rebuild once between them
+	time.Sleep(60 * time.Millisecond)
+	var wg sync.WaitGroup
+	var rebuilds atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rebuilt, _ := e.Refresh(50 * time.Millisecond); rebuilt {
+				rebuilds.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if rebuilds.Load() != 1 || provider.calls.Load() != 2 {
+		t.Errorf("concurrent refreshes made %d rebuilds and %d more fetches, want one shared", rebuilds.Load(), provider.calls.Load()-1)
+	}
+}
@@ -0,0 +1,374 @@
+package market
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// assetAliases are the full names people type instead of tickers.
+var assetAliases = map[string][]string{
+	"BTC":   {"BITCOIN", "XBT"},
+	"ETH":   {"ETHEREUM", "ETHER"},
+	"SOL":   {"SOLANA"},
+	"XRP":   {"RIPPLE"},
+	"BNB":   {"BINANCE COIN"},
+	"DOGE":  {"DOGECOIN", "XDG"},
+	"ADA":   {"CARDANO"},
+	"TRX":   {"TRON"},
+	"AVAX":  {"AVALANCHE"},
+	"LINK":  {"CHAINLINK"},
+	"TON":   {"TONCOIN"},
+	"SHIB":  {"SHIBA INU"},
+	"DOT":   {"POLKADOT"},
+	"LTC":   {"LITECOIN"},
+	"BCH":   {"BITCOIN CASH"},
+	"ETC":   {"ETHEREUM CLASSIC"},
+	"XLM":   {"STELLAR"},
+	"ATOM":  {"COSMOS"},
+	"UNI":   {"UNISWAP"},
+	"NEAR":  {"NEAR PROTOCOL"},
+	"POL":   {"POLYGON"},
+	"MATIC": {"POLYGON"},
+	"FIL":   {"FILECOIN"},
+	"ARB":   {"ARBITRUM"},
+	"OP":    {"OPTIMISM"},
+	"APT":   {"APTOS"},
+	"XMR":   {"MONERO"},
+	"USDT":  {"TETHER"},
+	"USDC":  {"USD COIN"},
+	"DAI":   {"DAI STABLECOIN"},
+	"USD":   {"DOLLAR", "US DOLLAR"},
+	"EUR":   {"EURO"},
+	"GBP":   {"POUND", "STERLING"},
+	"JPY":   {"YEN"},
+	"CHF":   {"FRANC"},
+}
+
+// majorBases orders base assets by how much they usually trade. It stands
+// in for volume when no listing reports any.
+var majorBases = []string{
+	"BTC", "ETH", "SOL", "XRP", "BNB", "DOGE", "USDT", "USDC", "ADA", "TRX",
+	"AVAX", "LINK", "TON", "SHIB", "DOT", "LTC", "BCH", "SUI", "PEPE", "NEAR",
+	"UNI", "XLM", "ATOM", "ETC", "POL", "MATIC", "FIL", "APT", "ARB", "OP",
+}
+
+// majorQuotes orders quote currencies by how commonly markets are wanted
+// in them.
+var majorQuotes = []string{"USD", "USDT", "USDC", "EUR", "BTC", "GBP", "ETH", "FDUSD", "JPY", "CAD", "AUD"}
+
+// Weights of each part of a product a query term can hit.
+const (
+	weightBase       = 100
+	weightBaseAlias  = 90
+	weightQuote      = 60
+	weightQuoteAlias = 50
+	weightCompact    = 80
+
+	// Added when the whole query spells the product, e.g. ETHUSD
+	bonusCompact = 100
+	// Added when the first term names the base, so "eth usd" puts ETH
+	// markets before those merely quoted in it
+	bonusBaseFirst  = 10
+	bonusMajorBase  = 15
+	bonusMajorQuote = 20
+	penaltyHalted   = 20
+	// Views raise a market by up to bonusPopular, growing with the log of
+	// its decayed view count so a few heavy markets cannot crowd out a
+	// better text match
+	bonusPopular     = 25
+	bonusPopularStep = 8
+)
+
+type fieldKind int
+
+const (
+	fieldBase fieldKind = iota
+	fieldQuote
+	fieldCompact
+)
+
+type searchField struct {
+	text   string
+	kind   fieldKind
+	weight float64
+}
+
+// searchEntry is a product prepared for matching.
+type searchEntry struct {
+	Product
+	compact string
+	fields  []searchField
+	// baseBonus is how heavily the base asset trades, see baseRanking
+	baseBonus float64
+}
+
+func newSearchEntry(p Product) searchEntry {
+	e := searchEntry{Product: p, compact: strings.Join(searchTerms(p.ID), "")}
+
+	base, quote := strings.ToUpper(p.Base), strings.ToUpper(p.Quote)
+	if base == "" {
+		// Products without a pair, e.g. SIM-BTC or a CSV file, are matched
+		// on the words of their id
+		for _, term := range searchTerms(p.ID) {
+			e.fields = append(e.fields, searchField{term, fieldBase, weightBase})
+		}
+	} else {
+		e.fields = append(e.fields, searchField{base, fieldBase, weightBase})
+		e.fields = appendAliases(e.fields, base, fieldBase, weightBaseAlias)
+	}
+	if quote != "" {
+		e.fields = append(e.fields, searchField{quote, fieldQuote, weightQuote})
+		e.fields = appendAliases(e.fields, quote, fieldQuote, weightQuoteAlias)
+	}
+	e.fields = append(e.fields, searchField{e.compact, fieldCompact, weightCompact})
+	return e
+}
+
+func appendAliases(fields []searchField, code string, kind fieldKind, weight float64) []searchField {
+	for _, alias := range assetAliases[code] {
+		for _, term := range searchTerms(alias) {
+			fields = append(fields, searchField{term, kind, weight})
+		}
+	}
+	return fields
+}
+
+// searchTerms splits text into upper case words, treating anything but
+// letters and digits as a separator.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToUpper(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// score rates how well the query terms describe the entry. Every term has
+// to hit some part of the product, otherwise the entry does not match.
+func (e *searchEntry) score(terms []string, compact string, popular map[Market]MarketScore) (float64, bool) {
+	var total float64
+	matched := true
+	for i, term := range terms {
+		best, kind := 0.0, fieldCompact
+		for _, f := range e.fields {
+			if s := f.weight * termMatch(term, f.text); s > best {
+				best, kind = s, f.kind
+			}
+		}
+		if best == 0 {
+			matched = false
+			break
+		}
+		total += best
+		if i == 0 && kind == fieldBase {
+			total += bonusBaseFirst
+		}
+	}
+
+	// "ETH US" and "ETHU" still read as the start of ETHUSD
+	if !matched {
+		q := termMatch(compact, e.compact)
+		if q == 0 {
+			return 0, false
+		}
+		total = weightCompact * q
+	}
+	if compact == e.compact {
+		total += bonusCompact
+	}
+	return total + e.standing(popular), true
+}
+
+// standing ranks entries apart from any query, favouring heavily traded
+// and often viewed markets and major quotes over halted markets.
+func (e *searchEntry) standing(popular map[Market]MarketScore) float64 {
+	s := e.baseBonus
+	if views := popular[Market{Exchange: e.Exchange, Symbol: e.ID}].Popular; views > 0 {
+		s += min(bonusPopular, bonusPopularStep*math.Log1p(views))
+	}
+	s += rankBonus(majorQuotes, strings.ToUpper(e.Quote), bonusMajorQuote)
+	if e.Status == StatusHalted {
+		s -= penaltyHalted
+	}
+	return s
+}
+
+// termMatch is 1 for an exact match, a little over half for a prefix,
+// growing as more of the field is typed, and less for a near miss.
+func termMatch(term, field string) float64 {
+	switch {
+	case term == field:
+		return 1
+	case strings.HasPrefix(field, term):
+		return 0.5 + 0.3*float64(len(term))/float64(len(field))
+	case withinTypos(term, field):
+		return 0.4
+	}
+	return 0
+}
+
+// withinTypos allows one edit in words of four or more letters and two in
+// words of seven or more. Shorter words are tickers, where one letter off
+// is usually another asset.
+func withinTypos(term, field string) bool {
+	allowed := 0
+	switch {
+	case len(term) >= 7:
+		allowed = 2
+	case len(term) >= 4:
+		allowed = 1
+	}
+	if allowed == 0 || abs(len(term)-len(field)) > allowed {
+		return false
+	}
+	return editDistance(term, field) <= allowed
+}
+
+// editDistance counts insertions, deletions, substitutions and swaps of
+// neighbouring letters.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// dollarQuotes are the quotes whose volumes are near enough to dollars to
+// be added up across markets.
+var dollarQuotes = map[string]bool{"USD": true, "USDT": true, "USDC": true, "FDUSD": true, "DAI": true}
+
+// baseRanking orders base assets by their dollar volume over every listed
+// market, most traded first, keeping as many as majorBases has. When no
+// listing reports volume it is majorBases.
+func baseRanking(entries []searchEntry) []string {
+	volumes := make(map[string]float64)
+	for _, e := range entries {
+		if e.Volume24h > 0 && dollarQuotes[strings.ToUpper(e.Quote)] {
+			volumes[strings.ToUpper(e.Base)] += e.Volume24h
+		}
+	}
+	if len(volumes) == 0 {
+		return majorBases
+	}
+
+	bases := make([]string, 0, len(volumes))
+	for base := range volumes {
+		bases = append(bases, base)
+	}
+	sort.Slice(bases, func(i, j int) bool {
+		if volumes[bases[i]] != volumes[bases[j]] {
+			return volumes[bases[i]] > volumes[bases[j]]
+		}
+		return bases[i] < bases[j]
+	})
+	return bases[:min(len(bases), len(majorBases))]
+}
+
+// rankBonus gives the first code in list the full bonus and later ones
+// steadily less.
+func rankBonus(list []string, code string, bonus float64) float64 {
+	for i, c := range list {
+		if c == code {
+			return bonus * float64(len(list)-i) / float64(len(list))
+		}
+	}
+	return 0
+}
+
+type scoredEntry struct {
+	entry *searchEntry
+	score float64
+}
+
+// rankEntries returns the entries passing filter that match query, best
+// first, with popular giving each market's views. An empty query matches
+// every entry, ranked by standing alone. Ties go to the shorter id, then
+// alphabetically, so results are stable.
+func rankEntries(entries []searchEntry, query string, filter SearchFilter, popular map[Market]MarketScore) []scoredEntry {
+	terms := searchTerms(query)
+	compact := strings.Join(terms, "")
+
+	var ranked []scoredEntry
+	for i := range entries {
+		e := &entries[i]
+		if !filter.matches(e.Product) {
+			continue
+		}
+		if len(terms) == 0 {
+			ranked = append(ranked, scoredEntry{e, e.standing(popular)})
+		} else if s, ok := e.score(terms, compact, popular); ok {
+			ranked = append(ranked, scoredEntry{e, s})
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.entry.compact) != len(b.entry.compact) {
+			return len(a.entry.compact) < len(b.entry.compact)
+		}
+		if a.entry.Name != b.entry.Name {
+			return a.entry.Name < b.entry.Name
+		}
+		return a.entry.Exchange < b.entry.Exchange
+	})
+	return ranked
+}
+
+// SearchFilter narrows search results. Empty fields allow everything and a
+// field with several values allows any of them. Values are compared
+// without regard to case.
+type SearchFilter struct {
+	Exchanges []string
+	Types     []string
+	Quotes    []string
+	Statuses  []string
+}
+
+// IsZero reports whether the filter allows every product.
+func (f SearchFilter) IsZero() bool {
+	return len(f.Exchanges) == 0 && len(f.Types) == 0 && len(f.Quotes) == 0 && len(f.Statuses) == 0
+}
+
+func (f SearchFilter) matches(p Product) bool {
+	return anyFold(f.Exchanges, p.Exchange) && anyFold(f.Types, p.Type) &&
+		anyFold(f.Quotes, p.Quote) && anyFold(f.Statuses, p.Status)
+}
+
+func anyFold(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	return false
+}
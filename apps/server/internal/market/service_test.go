@@ -0,0 +1,89 @@
+package market
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0men1/cochart/internal/market/cassette"
+)
+
+func openCassette(t *testing.T, name string) *cassette.Cassette {
+	t.Helper()
+	c, err := cassette.Open("testdata/cassettes/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.Save(); err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+func TestFetchCandlesFromCassette(t *testing.T) {
+	c := openCassette(t, "coinbase_candles.json")
+	service := NewService(map[string]ExchangeProvider{
+		"coinbase": &CoinbaseProvider{Client: c.Client(), BaseURL: "https://api.exchange.coinbase.com"},
+	})
+
+	// The first recorded answer is a 429, the retry gets the candles
+	candles, err := service.FetchCandles(context.Background(), "coinbase", "BTC-USD", 1717200000, 1717218000, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(candles) != 6 {
+		t.Fatalf("got %d candles, want 6", len(candles))
+	}
+	for i, c := range candles {
+		if want := int64(1717200000 + i*3600); c.Timestamp != want {
+			t.Errorf("candle %d at %d, want %d", i, c.Timestamp, want)
+		}
+	}
+	first := Candlestick{Timestamp: 1717200000, Open: 67530.12, High: 67688.5, Low: 67420.01, Close: 67601.33, Volume: 412.2188}
+	if candles[0] != first {
+		t.Errorf("first candle = %+v, want %+v", candles[0], first)
+	}
+}
+
+func TestBuildIndexFromCassette(t *testing.T) {
+	c := openCassette(t, "products.json")
+	engine := NewEngine(map[string]ExchangeProvider{
+		"coinbase": &CoinbaseProvider{Client: c.Client(), BaseURL: "https://api.exchange.coinbase.com"},
+		"binance":  &BinanceProvider{Client: c.Client(), BaseURL: "https://api.binance.com"},
+	}, nil)
+
+	got := engine.Search("BTC", 10)
+	want := map[string]bool{"coinbase BTC-USD": true, "coinbase BTC-EUR": true, "binance BTC/USDT": true, "binance ETH/BTC": true}
+	if len(got) != len(want) {
+		t.Fatalf("search BTC returned %+v", got)
+	}
+	if last := got[len(got)-1]; last.ID != "ETH/BTC" {
+		t.Errorf("market quoted in BTC ranked above BTC markets: %+v", got)
+	}
+	for _, p := range got {
+		if !want[p.Exchange+" "+p.ID] {
+			t.Errorf("unexpected result %+v", p)
+		}
+	}
+
+	if got := engine.Search("MKR", 10); len(got) != 0 {
+		t.Errorf("delisted product found: %+v", got)
+	}
+
+	p, ok := engine.Product("coinbase", "BTC/USD")
+	if !ok {
+		t.Fatal("BTC/USD not found on coinbase by canonical symbol")
+	}
+	if p.ID != "BTC-USD" || p.PriceIncrement != 0.01 || p.PricePrecision != 2 || p.SizePrecision != 8 || p.MinSize != 0.00001 || p.Status != StatusOnline || !p.Margin {
+		t.Errorf("BTC-USD metadata = %+v", p)
+	}
+	// Coinbase reports base volume and the last price, Binance quote volume
+	if want := 9812.5 * 69820.0; p.Volume24h != want {
+		t.Errorf("BTC-USD volume = %v, want %v", p.Volume24h, want)
+	}
+	if p, _ := engine.Product("binance", "BNB/USDT"); p.Volume24h != 250120374.801 {
+		t.Errorf("BNB/USDT volume = %v", p.Volume24h)
+	}
+}
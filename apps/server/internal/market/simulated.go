@@ -0,0 +1,430 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+type SimModel string
+
+const (
+	// SimRandomWalk moves the price by normally distributed amounts
+	SimRandomWalk SimModel = "walk"
+	// SimGBM is geometric Brownian motion, the log price is a random walk
+	SimGBM SimModel = "gbm"
+	// SimRegimes is GBM whose volatility switches between calm, normal and
+	// turbulent stretches of about nine hours
+	SimRegimes SimModel = "regimes"
+)
+
+// SimulatedMarket configures one generated symbol. Price is the level at
+// simAnchor, Volatility the daily standard deviation of returns and Drift
+// the expected daily log return. GapRate is the share of hours that have no
+// data at all, as if the venue were down.
+type SimulatedMarket struct {
+	Symbol     string   `json:"symbol"`
+	Model      SimModel `json:"model"`
+	Price      float64  `json:"price"`
+	Volatility float64  `json:"volatility"`
+	Drift      float64  `json:"drift"`
+	Volume     float64  `json:"volume"`
+	GapRate    float64  `json:"gapRate"`
+}
+
+// LoadSimulatedMarkets reads a JSON array of markets, such as
+//
+//	[{"symbol": "SIM-SOL", "model": "regimes", "price": 100, "volatility": 0.05, "drift": 0.001, "volume": 30}]
+//
+// Model defaults to gbm and Volume to 1.
+func LoadSimulatedMarkets(path string) ([]SimulatedMarket, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var markets []SimulatedMarket
+	if err := json.Unmarshal(data, &markets); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(markets) == 0 {
+		return nil, fmt.Errorf("%s: no markets", path)
+	}
+
+	seen := make(map[string]bool, len(markets))
+	for i := range markets {
+		m := &markets[i]
+		if m.Model == "" {
+			m.Model = SimGBM
+		}
+		if m.Volume == 0 {
+			m.Volume = 1
+		}
+
+		switch {
+		case m.Symbol == "":
+			return nil, fmt.Errorf("%s: market %d has no symbol", path, i)
+		case seen[m.Symbol]:
+			return nil, fmt.Errorf("%s: %s is listed twice", path, m.Symbol)
+		case m.Model != SimRandomWalk && m.Model != SimGBM && m.Model != SimRegimes:
+			return nil, fmt.Errorf("%s: %s: unknown model %q, want walk, gbm or regimes", path, m.Symbol, m.Model)
+		case m.Price <= 0, m.Volatility < 0, m.Volume < 0:
+			return nil, fmt.Errorf("%s: %s: price must be positive, volatility and volume not negative", path, m.Symbol)
+		case m.GapRate < 0 || m.GapRate >= 1:
+			return nil, fmt.Errorf("%s: %s: gapRate must be at least 0 and below 1", path, m.Symbol)
+		}
+		seen[m.Symbol] = true
+	}
+	return markets, nil
+}
+
+// SimulatedProvider generates reproducible markets with no network access.
+// Every price is a pure function of Seed, the symbol and the second it is
+// asked for, so any range can be produced on its own and the live ticks
+// line up with history.
+type SimulatedProvider struct {
+	Seed         uint64
+	Markets      []SimulatedMarket
+	TickInterval time.Duration
+}
+
+const (
+	// simAnchor is when each market trades at its configured Price
+	simAnchor = 1704067200 // 2024-01-01
+	// simDepth covers every second from the epoch until 2106
+	simDepth = 32
+	// simRegimeLength is how long a volatility regime lasts, in seconds
+	simRegimeLength = 1 << 15
+)
+
+// simRegimes are volatility multipliers and their odds. Their mean square is
+// about one, so regimes leave the long run volatility unchanged.
+var simRegimes = []struct {
+	odds, scale float64
+}{
+	{0.4, 0.35},
+	{0.4, 0.9},
+	{0.2, 1.77},
+}
+
+func NewSimulatedProvider(seed uint64) *SimulatedProvider {
+	return &SimulatedProvider{
+		Seed: seed,
+		Markets: []SimulatedMarket{
+			{Symbol: "SIM-BTC", Model: SimGBM, Price: 42000, Volatility: 0.03, Drift: 0.0005, Volume: 2},
+			{Symbol: "SIM-ETH", Model: SimRegimes, Price: 2300, Volatility: 0.035, Volume: 20},
+			{Symbol: "SIM-FX", Model: SimRandomWalk, Price: 1.1, Volatility: 0.004, Volume: 5000},
+			{Symbol: "SIM-OTC", Model: SimGBM, Price: 100, Volatility: 0.02, Volume: 50, GapRate: 0.1},
+		},
+		TickInterval: time.Second,
+	}
+}
+
+func (p *SimulatedProvider) ID() string {
+	return "simulated"
+}
+
+func (p *SimulatedProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Granularities:        []int64{60, 180, 300, 900, 1800, 3600, 7200, 14400, 21600, 43200, 86400},
+		MaxCandlesPerRequest: 1000,
+		AssetTypes:           []string{"simulated"},
+		// A new seed makes new history, so none is kept across restarts
+		Generated: true,
+	}
+}
+
+func (p *SimulatedProvider) RateLimit() RateLimit {
+	return RateLimit{}
+}
+
+func (p *SimulatedProvider) GetProducts() ([]Product, error) {
+	products := make([]Product, 0, len(p.Markets))
+	for _, m := range p.Markets {
+		products = append(products, Product{
+			ID:       m.Symbol,
+			Name:     m.Symbol,
+			Type:     "simulated",
+			Exchange: "simulated",
+
+			PricePrecision: pricePrecision(m.Price),
+			Status:         StatusOnline,
+		})
+	}
+	return products, nil
+}
+
+func (p *SimulatedProvider) market(symbol string) (simSeries, error) {
+	for _, m := range p.Markets {
+		if m.Symbol == symbol {
+			h := fnv.New64a()
+			h.Write([]byte(symbol))
+			s := simSeries{SimulatedMarket: m, seed: p.Seed ^ h.Sum64()}
+			s.anchor = s.brownian(simAnchor)
+			return s, nil
+		}
+	}
+	return simSeries{}, &ProviderError{Provider: "simulated", Kind: ErrNotFound, Message: symbol}
+}
+
+// simCandleSamples is how many evenly spaced prices make up a candle's high
+// and low. One minute candles see every second.
+const simCandleSamples = 60
+
+func (p *SimulatedProvider) FetchCandles(ctx context.Context, symbol string, start, end, granularity int64) ([]Candlestick, error) {
+	m, err := p.market(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if granularity <= 0 {
+		return nil, &ProviderError{Provider: "simulated", Kind: ErrBadRequest, Message: fmt.Sprintf("granularity %d", granularity)}
+	}
+
+	now := time.Now().Unix()
+	step := max(granularity/simCandleSamples, 1)
+
+	var candles []Candlestick
+	for t := floorDiv(start, granularity) * granularity; t <= end && t <= now; t += granularity {
+		if t < start || m.down(t) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		c := Candlestick{Timestamp: t, Open: m.price(t)}
+		c.High, c.Low, c.Close = c.Open, c.Open, c.Open
+		// The candle still forming ends at the current second
+		last := min(t+granularity, now)
+		for s := t + step; s <= last; s += step {
+			price := m.price(min(s, last))
+			c.High = max(c.High, price)
+			c.Low = min(c.Low, price)
+			c.Close = price
+		}
+		c.Volume = m.volume(t, last-t, c)
+		candles = append(candles, c)
+	}
+
+	return candles, nil
+}
+
+type simSeries struct {
+	SimulatedMarket
+	seed   uint64
+	anchor float64
+}
+
+func (m simSeries) price(t int64) float64 {
+	w := m.brownian(t) - m.anchor
+	days := float64(t-simAnchor) / day
+
+	switch m.Model {
+	case SimRandomWalk:
+		// Reflect at a hundredth of the start price so it never crosses zero
+		floor := m.Price / 100
+		return floor + math.Abs(m.Price*(1+m.Volatility*w)-floor)
+	default:
+		return m.Price * math.Exp(m.Volatility*w+(m.Drift-m.Volatility*m.Volatility/2)*days)
+	}
+}
+
+// brownian returns a standard Brownian motion with unit variance per day at
+// second t. It is built top down by midpoint displacement, so a point costs
+// simDepth hashes no matter where it is.
+func (m simSeries) brownian(t int64) float64 {
+	t = min(max(t, 0), 1<<simDepth)
+
+	a, b := int64(0), int64(1)<<simDepth
+	wa, wb := 0.0, math.Sqrt(float64(b)/day)*m.normal(0, b)
+	for b-a > 1 {
+		if t == a {
+			return wa
+		}
+		if t == b {
+			return wb
+		}
+
+		mid := (a + b) / 2
+		wm := (wa+wb)/2 + math.Sqrt(float64(b-a)/4/day)*m.scale(a, b)*m.normal(a, b)
+		if t < mid {
+			b, wb = mid, wm
+		} else {
+			a, wa = mid, wm
+		}
+	}
+
+	if t == a {
+		return wa
+	}
+	return wb
+}
+
+// scale is the volatility multiplier for displacing the midpoint of [a, b].
+// Only spans within a single regime feel it, longer ones average out.
+func (m simSeries) scale(a, b int64) float64 {
+	if m.Model != SimRegimes || b-a > simRegimeLength {
+		return 1
+	}
+
+	u := m.uniform(uint64(a/simRegimeLength), 0x7265)
+	for _, r := range simRegimes {
+		if u < r.odds {
+			return r.scale
+		}
+		u -= r.odds
+	}
+	return simRegimes[len(simRegimes)-1].scale
+}
+
+func (m simSeries) down(t int64) bool {
+	return m.GapRate > 0 && m.uniform(uint64(floorDiv(t, 3600)), 0x6761) < m.GapRate
+}
+
+// volume scales the market's base volume per minute with the length of the
+// candle and how far price travelled within it.
+func (m simSeries) volume(t, length int64, c Candlestick) float64 {
+	if m.Volume == 0 || length <= 0 {
+		return 0
+	}
+
+	minutes := float64(length) / 60
+	expected := m.Volatility * math.Sqrt(float64(length)/day)
+	travel := 0.0
+	if expected > 0 && c.Open > 0 {
+		travel = (c.High - c.Low) / c.Open / expected
+	}
+
+	noise := math.Exp(0.3*m.normalAt(uint64(t), uint64(length)) - 0.045)
+	return m.Volume * minutes * (0.5 + 0.5*travel) * noise
+}
+
+func (m simSeries) normal(a, b int64) float64 {
+	return m.normalAt(uint64(a), uint64(b))
+}
+
+// normalAt turns two hashed uniforms into a standard normal (Box-Muller).
+func (m simSeries) normalAt(x, y uint64) float64 {
+	u1 := m.uniform(x, y)
+	u2 := m.uniform(y, x^0x9e3779b97f4a7c15)
+	return math.Sqrt(-2*math.Log(1-u1)) * math.Cos(2*math.Pi*u2)
+}
+
+// uniform hashes x and y into [0, 1).
+func (m simSeries) uniform(x, y uint64) float64 {
+	h := splitmix(m.seed ^ splitmix(x^splitmix(y)))
+	return float64(h>>11) / (1 << 53)
+}
+
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+type simStream struct {
+	provider *SimulatedProvider
+	cancel   context.CancelFunc
+	ticks    chan Tick
+
+	mu      sync.Mutex
+	symbols map[string]simSeries
+}
+
+// OpenTickStream ticks every subscribed symbol each TickInterval with the
+// same prices FetchCandles reports for that second.
+func (p *SimulatedProvider) OpenTickStream(ctx context.Context) (TickStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &simStream{provider: p, cancel: cancel, ticks: make(chan Tick, 256), symbols: make(map[string]simSeries)}
+	go s.run(ctx)
+	return s, nil
+}
+
+func (s *simStream) Subscribe(symbols ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, symbol := range symbols {
+		m, err := s.provider.market(symbol)
+		if err != nil {
+			return err
+		}
+		s.symbols[symbol] = m
+	}
+	return nil
+}
+
+func (s *simStream) Unsubscribe(symbols ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, symbol := range symbols {
+		delete(s.symbols, symbol)
+	}
+	return nil
+}
+
+func (s *simStream) Ticks() <-chan Tick {
+	return s.ticks
+}
+
+func (s *simStream) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *simStream) run(ctx context.Context) {
+	defer close(s.ticks)
+
+	interval := s.provider.TickInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			markets := make([]simSeries, 0, len(s.symbols))
+			for _, m := range s.symbols {
+				markets = append(markets, m)
+			}
+			s.mu.Unlock()
+
+			t := now.Unix()
+			for _, m := range markets {
+				if m.down(t) {
+					continue
+				}
+
+				price := m.price(t)
+				spread := price * 0.0001
+				tick := Tick{
+					Exchange:  "simulated",
+					Symbol:    m.Symbol,
+					Price:     price,
+					Size:      m.Volume / 60 * math.Exp(m.normalAt(uint64(t), 0x7469)),
+					Bid:       price - spread/2,
+					Ask:       price + spread/2,
+					Timestamp: t,
+				}
+
+				select {
+				case s.ticks <- tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSimulatedIsReproducible(t *testing.T) {
+	ctx := context.Background()
+	start, end := utc(2024, 6, 1, 0, 0), utc(2024, 6, 1, 5, 0)
+
+	fetch := func(p *SimulatedProvider, start, end, granularity int64) []Candlestick {
+		t.Helper()
+		candles, err := p.FetchCandles(ctx, "SIM-BTC", start, end, granularity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return candles
+	}
+
+	whole := fetch(NewSimulatedProvider(7), start, end, 60)
+	if len(whole) != 301 {
+		t.Fatalf("got %d candles, want 301", len(whole))
+	}
+	// Another instance, or the range asked for in pieces, gives the same
+	// candles
+	pieces := append(fetch(NewSimulatedProvider(7), start, start+3000, 60), fetch(NewSimulatedProvider(7), start+3060, end, 60)...)
+	for i := range whole {
+		if pieces[i] != whole[i] {
+			t.Fatalf("candle %d = %+v in pieces, %+v whole", i, pieces[i], whole[i])
+		}
+	}
+
+	// Coarser candles open and close where the fine ones do
+	five := fetch(NewSimulatedProvider(7), start, end, 300)
+	for i, c := range five {
+		if c.Open != whole[i*5].Open || (i*5+4 < len(whole) && c.Close != whole[i*5+4].Close) {
+			t.Fatalf("five minute candle %d = %+v, doesn't match its minutes", i, c)
+		}
+	}
+
+	if other := fetch(NewSimulatedProvider(8), start, end, 60); other[0] == whole[0] {
+		t.Error("another seed made the same market")
+	}
+}
+
+func TestSimulatedGapsAndBounds(t *testing.T) {
+	p := NewSimulatedProvider(7)
+	ctx := context.Background()
+
+	candles, err := p.FetchCandles(ctx, "SIM-OTC", utc(2024, 6, 1, 0, 0), utc(2024, 6, 11, 0, 0), 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hours := len(candles); hours == 0 || hours >= 240 {
+		t.Errorf("got %d of 241 hours, want some missing", hours)
+	}
+
+	// Nothing from the future
+	now := time.Now().Unix()
+	candles, _ = p.FetchCandles(ctx, "SIM-BTC", now-600, now+3600, 60)
+	if last := candles[len(candles)-1].Timestamp; last > now {
+		t.Errorf("candle at %d is after now %d", last, now)
+	}
+
+	if _, err := p.FetchCandles(ctx, "SIM-NONE", 0, 60, 60); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown symbol: got %v, want not found", err)
+	}
+	if _, err := p.FetchCandles(ctx, "SIM-BTC", 0, 60, 0); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("zero granularity: got %v, want bad request", err)
+	}
+}
+
+func TestSimulatedTicksMatchHistory(t *testing.T) {
+	p := NewSimulatedProvider(7)
+	p.TickInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := p.OpenTickStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err := stream.Subscribe("SIM-BTC"); err != nil {
+		t.Fatal(err)
+	}
+
+	tick := <-stream.Ticks()
+	candles, err := p.FetchCandles(ctx, "SIM-BTC", tick.Timestamp, tick.Timestamp, 1)
+	if err != nil || len(candles) != 1 || candles[0].Open != tick.Price {
+		t.Errorf("tick %+v, history %+v %v", tick, candles, err)
+	}
+	if tick.Bid >= tick.Price || tick.Ask <= tick.Price {
+		t.Errorf("tick %+v is outside its spread", tick)
+	}
+}
+
+func TestSimulatedHistoryIsNotStored(t *testing.T) {
+	store, err := OpenDiskStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(map[string]ExchangeProvider{"simulated": NewSimulatedProvider(7)})
+	service.Store = store
+
+	// One whole block, long settled
+	start := utc(2024, 6, 1, 0, 0)
+	if _, err := service.FetchCandles(context.Background(), "simulated", "SIM-BTC", start, start+60000, 60); err != nil {
+		t.Fatal(err)
+	}
+	// A different SIM_SEED next run must not be served this run's history
+	if store.Size() != 0 {
+		t.Errorf("stored %d bytes of generated history", store.Size())
+	}
+	if cached := service.GetFromCache(context.Background(), "SIM-BTC", "simulated", start, 60); len(cached) == 0 {
+		t.Error("generated history was not cached")
+	}
+}
+
+func TestLoadSimulatedMarkets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(data string) string {
+		t.Helper()
+		path := filepath.Join(dir, "markets.json")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	markets, err := LoadSimulatedMarkets(write(`[
+		{"symbol": "SIM-SOL", "model": "regimes", "price": 100, "volatility": 0.05, "drift": 0.001, "volume": 30},
+		{"symbol": "SIM-UP", "price": 10, "volatility": 0, "drift": 0.01}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SimulatedMarket{
+		{Symbol: "SIM-SOL", Model: SimRegimes, Price: 100, Volatility: 0.05, Drift: 0.001, Volume: 30},
+		{Symbol: "SIM-UP", Model: SimGBM, Price: 10, Drift: 0.01, Volume: 1},
+	}
+	if len(markets) != len(want) || markets[0] != want[0] || markets[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", markets, want)
+	}
+
+	// Without volatility the price follows the drift alone
+	p := NewSimulatedProvider(7)
+	p.Markets = markets
+	at := int64(simAnchor + 10*day)
+	candles, err := p.FetchCandles(context.Background(), "SIM-UP", at, at, 60)
+	if err != nil || len(candles) != 1 {
+		t.Fatalf("got %+v, %v", candles, err)
+	}
+	if got, want := candles[0].Open, 10*math.Exp(0.1); math.Abs(got-want) > 1e-9 {
+		t.Errorf("SIM-UP opened at %v ten days in, want %v", got, want)
+	}
+	if _, err := p.FetchCandles(context.Background(), "SIM-BTC", at, at, 60); !errors.Is(err, ErrNotFound) {
+		t.Errorf("default market still served: %v", err)
+	}
+
+	for _, bad := range []string{
+		`[]`,
+		`[{"price": 1}]`,
+		`[{"symbol": "A", "price": 1}, {"symbol": "A", "price": 2}]`,
+		`[{"symbol": "A", "model": "chaos", "price": 1}]`,
+		`[{"symbol": "A", "price": 0}]`,
+		`[{"symbol": "A", "price": 1, "gapRate": 1}]`,
+		`{"symbol": "A"}`,
+	} {
+		if _, err := LoadSimulatedMarkets(write(bad)); err == nil {
+			t.Errorf("%s was accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+type Tick struct {
+	Exchange string  `json:"exchange"`
+	Symbol   string  `json:"symbol"`
+	Price    float64 `json:"price"`
+	// Size is the amount traded by a tick reporting a single trade, and zero
+	// for quote updates. Candle volume is the sum of it.
+	Size      float64 `json:"size,omitempty"`
+	Volume    float64 `json:"volume,omitempty"`
+	Bid       float64 `json:"bid,omitempty"`
+	Ask       float64 `json:"ask,omitempty"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// TickStream is a single upstream connection carrying ticker updates for
+// any number of symbols. Ticks is closed when the connection is lost.
+type TickStream interface {
+	Subscribe(symbols ...string) error
+	Unsubscribe(symbols ...string) error
+	Ticks() <-chan Tick
+	Close() error
+}
+
+// LiveProvider is implemented by providers that can stream ticker updates.
+type LiveProvider interface {
+	OpenTickStream(ctx context.Context) (TickStream, error)
+}
+
+// Streamer keeps one upstream subscription per symbol and fans its ticks
+// out to every subscriber. Upstream connections are opened on first use and
+// closed once the last subscriber for an exchange goes away.
+type Streamer struct {
+	Providers map[string]ExchangeProvider
+
+	mu    sync.Mutex
+	feeds map[string]*feed
+}
+
+type feed struct {
+	provider LiveProvider
+	stream   TickStream
+	cancel   context.CancelFunc
+	subs     map[string]map[int]func(Tick)
+	nextID   int
+}
+
+func NewStreamer(providers map[string]ExchangeProvider) *Streamer {
+	return &Streamer{Providers: providers, feeds: make(map[string]*feed)}
+}
+
+// Subscribe registers fn for ticks of symbol on exchange and returns a func
+// that removes the subscription again.
+func (s *Streamer) Subscribe(exchange, symbol string, fn func(Tick)) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[exchange]
+	if !ok {
+		provider, exists := s.Providers[exchange]
+		if !exists {
+			return nil, fmt.Errorf("exchange %s not found", exchange)
+		}
+		live, ok := provider.(LiveProvider)
+		if !ok {
+			return nil, fmt.Errorf("exchange %s does not support streaming", exchange)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		f = &feed{provider: live, cancel: cancel, subs: make(map[string]map[int]func(Tick))}
+		s.feeds[exchange] = f
+		go s.run(ctx, exchange, f)
+	}
+
+	subs, ok := f.subs[symbol]
+	if !ok {
+		subs = make(map[int]func(Tick))
+		f.subs[symbol] = subs
+		if f.stream != nil {
+			if err := f.stream.Subscribe(symbol); err != nil {
+				log.Printf("Subscribe %s on %s: %v", symbol, exchange, err)
+			}
+		}
+	}
+
+	id := f.nextID
+	f.nextID++
+	subs[id] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.unsubscribe(exchange, symbol, f, id) })
+	}, nil
+}
+
+func (s *Streamer) unsubscribe(exchange, symbol string, f *feed, id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := f.subs[symbol]
+	delete(subs, id)
+	if len(subs) > 0 {
+		return
+	}
+
+	delete(f.subs, symbol)
+	if f.stream != nil {
+		if err := f.stream.Unsubscribe(symbol); err != nil {
+			log.Printf("Unsubscribe %s on %s: %v", symbol, exchange, err)
+		}
+	}
+
+	if len(f.subs) == 0 {
+		f.cancel()
+		if f.stream != nil {
+			f.stream.Close()
+			f.stream = nil
+		}
+		delete(s.feeds, exchange)
+	}
+}
+
+// run keeps the upstream connection for one exchange alive, reconnecting
+// and resubscribing with backoff until the feed is cancelled.
+func (s *Streamer) run(ctx context.Context, exchange string, f *feed) {
+	for attempt := 0; ; attempt++ {
+		stream, err := f.provider.OpenTickStream(ctx)
+		if err == nil {
+			if s.attach(ctx, f, stream) {
+				attempt = 0
+				s.pump(f, stream)
+			} else {
+				stream.Close()
+			}
+		} else {
+			log.Printf("Tick stream for %s: %v", exchange, err)
+		}
+
+		backoff := time.Duration(500*(1<<min(attempt, 6))) * time.Millisecond
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (s *Streamer) attach(ctx context.Context, f *feed, stream TickStream) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	symbols := make([]string, 0, len(f.subs))
+	for symbol := range f.subs {
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) > 0 {
+		if err := stream.Subscribe(symbols...); err != nil {
+			return false
+		}
+	}
+
+	f.stream = stream
+	return true
+}
+
+func (s *Streamer) pump(f *feed, stream TickStream) {
+	for tick := range stream.Ticks() {
+		s.mu.Lock()
+		fns := make([]func(Tick), 0, len(f.subs[tick.Symbol]))
+		for _, fn := range f.subs[tick.Symbol] {
+			fns = append(fns, fn)
+		}
+		s.mu.Unlock()
+
+		for _, fn := range fns {
+			fn(tick)
+		}
+	}
+
+	s.mu.Lock()
+	if f.stream == stream {
+		f.stream = nil
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,207 @@
+package market
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeExchange speaks enough of the Coinbase feed protocol to stand in for
+// ws-feed.exchange.coinbase.com.
+type fakeExchange struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	conns    []*websocket.Conn
+	messages []coinbaseSubscription
+	changed  chan struct{}
+}
+
+func newFakeExchange(t *testing.T) *fakeExchange {
+	f := &fakeExchange{changed: make(chan struct{}, 64)}
+	upgrader := websocket.Upgrader{}
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		f.mu.Unlock()
+		f.changed <- struct{}{}
+
+		for {
+			var msg coinbaseSubscription
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, msg)
+			f.mu.Unlock()
+			f.changed <- struct{}{}
+		}
+	}))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeExchange) url() string {
+	return "ws" + strings.TrimPrefix(f.server.URL, "http")
+}
+
+func (f *fakeExchange) waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		f.mu.Lock()
+		ok := cond()
+		f.mu.Unlock()
+		if ok {
+			return
+		}
+		select {
+		case <-f.changed:
+		case <-deadline:
+			t.Fatal("timed out waiting for fake exchange")
+		}
+	}
+}
+
+func (f *fakeExchange) sendTicker(t *testing.T, productID, price string) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		conn.WriteJSON(coinbaseTicker{
+			Type:      "ticker",
+			ProductID: productID,
+			Price:     price,
+			Time:      "2024-06-01T12:00:00.000000Z",
+		})
+	}
+}
+
+func TestStreamerSharesUpstreamSubscription(t *testing.T) {
+	exchange := newFakeExchange(t)
+	streamer := NewStreamer(map[string]ExchangeProvider{
+		"coinbase": &CoinbaseProvider{WSURL: exchange.url()},
+	})
+
+	ticks := make(chan Tick, 8)
+	forward := func(tick Tick) { ticks <- tick }
+
+	unsubscribeA, err := streamer.Subscribe("coinbase", "BTC-USD", forward)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsubscribeB, err := streamer.Subscribe("coinbase", "BTC-USD", forward)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange.waitFor(t, func() bool { return len(exchange.messages) == 1 })
+	if len(exchange.conns) != 1 {
+		t.Fatalf("got %d upstream connections, want 1", len(exchange.conns))
+	}
+	if got := exchange.messages[0]; got.Type != "subscribe" || len(got.ProductIDs) != 1 || got.ProductIDs[0] != "BTC-USD" {
+		t.Fatalf("unexpected subscription %+v", got)
+	}
+
+	exchange.sendTicker(t, "BTC-USD", "67000.5")
+	for range 2 {
+		select {
+		case tick := <-ticks:
+			if tick.Symbol != "BTC-USD" || tick.Price != 67000.5 || tick.Timestamp != 1717243200 {
+				t.Fatalf("unexpected tick %+v", tick)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("tick was not fanned out to both subscribers")
+		}
+	}
+
+	unsubscribeA()
+	unsubscribeA()
+	exchange.sendTicker(t, "BTC-USD", "67001")
+	select {
+	case <-ticks:
+	case <-time.After(2 * time.Second):
+		t.Fatal("remaining subscriber stopped receiving ticks")
+	}
+
+	exchange.mu.Lock()
+	if len(exchange.messages) != 1 {
+		t.Fatalf("upstream unsubscribed while a subscriber remained: %+v", exchange.messages)
+	}
+	exchange.mu.Unlock()
+
+	unsubscribeB()
+	exchange.waitFor(t, func() bool { return len(exchange.messages) == 2 })
+	if got := exchange.messages[1]; got.Type != "unsubscribe" || got.ProductIDs[0] != "BTC-USD" {
+		t.Fatalf("unexpected unsubscription %+v", got)
+	}
+}
+
+func TestCoinbaseVolumeComesFromMatches(t *testing.T) {
+	exchange := newFakeExchange(t)
+	stream, err := (&CoinbaseProvider{WSURL: exchange.url()}).OpenTickStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	if err := stream.Subscribe("BTC-USD"); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange.waitFor(t, func() bool { return len(exchange.messages) == 1 })
+	if got := exchange.messages[0].Channels; len(got) != 2 || got[1] != "matches" {
+		t.Fatalf("subscribed to %v, want ticker and matches", got)
+	}
+
+	exchange.mu.Lock()
+	conn := exchange.conns[0]
+	for _, msg := range []coinbaseTicker{
+		{Type: "last_match", ProductID: "BTC-USD", Price: "66990", Size: "5"},
+		{Type: "match", ProductID: "BTC-USD", Price: "67000", Size: "0.25"},
+		{Type: "match", ProductID: "BTC-USD", Price: "67001", Size: "0.5"},
+		{Type: "ticker", ProductID: "BTC-USD", Price: "67001", BestBid: "67000", BestAsk: "67002"},
+		{Type: "match", ProductID: "BTC-USD", Price: "67002", Size: "0.25"},
+	} {
+		conn.WriteJSON(msg)
+	}
+	exchange.mu.Unlock()
+
+	// One tick per trade, the ticker only brings the quote
+	var volume float64
+	var last Tick
+	for range 3 {
+		select {
+		case last = <-stream.Ticks():
+			volume += last.Size
+		case <-time.After(2 * time.Second):
+			t.Fatal("tick did not arrive")
+		}
+	}
+	if volume != 1 {
+		t.Errorf("got volume %v, want 1 from the three matches", volume)
+	}
+	if last.Price != 67002 || last.Bid != 67000 || last.Ask != 67002 {
+		t.Errorf("last tick %+v, want the trade with the ticker's quote", last)
+	}
+}
+
+func TestStreamerRejectsUnknownExchange(t *testing.T) {
+	streamer := NewStreamer(map[string]ExchangeProvider{})
+	if _, err := streamer.Subscribe("nowhere", "BTC-USD", func(Tick) {}); err == nil {
+		t.Fatal("expected an error for an unknown exchange")
+	}
+}
@@ -2,6 +2,7 @@ package rooms
 
 import (
 	"bytes"
+	"compress/flate"
 	"log"
 	"time"
 
@@ -13,11 +14,34 @@ type Message struct {
 	Sender *Client
 }
 
+// WriteConfig controls how queued messages are framed on the way out.
+type WriteConfig struct {
+	// MaxBatch caps how many queued messages are joined into one frame.
+	// Messages in a batched frame are separated by a newline.
+	MaxBatch int
+	// CompressionThreshold is the frame size in bytes from which
+	// permessage-deflate is used, if the peer negotiated it. Zero disables it.
+	CompressionThreshold int
+	CompressionLevel     int
+}
+
+var DefaultWriteConfig = WriteConfig{
+	MaxBatch:             64,
+	CompressionThreshold: 512,
+	CompressionLevel:     flate.BestSpeed,
+}
+
+var (
+	newline = []byte{'\n'}
+	space   = []byte{' '}
+)
+
 type Client struct {
 	Conn        *websocket.Conn
 	DisplayName string
 	Send        chan []byte
 	Room        *Room
+	Config      WriteConfig
 }
 
 type Action struct {
@@ -48,7 +72,9 @@ func (c *Client) startRead() {
 			break
 		}
 
-		message = bytes.TrimSpace(message)
+		// Outgoing frames are newline delimited, so a message must not carry
+		// one of its own
+		message = bytes.ReplaceAll(bytes.TrimSpace(message), newline, space)
 		c.Room.Broadcast <- &Message{
 			Data:   message,
 			Sender: c,
@@ -63,6 +89,11 @@ func (c *Client) startWrite() {
 		c.Conn.Close()
 	}()
 
+	if c.Config.CompressionThreshold > 0 {
+		c.Conn.SetCompressionLevel(c.Config.CompressionLevel)
+	}
+
+	batch := make([][]byte, 0, max(c.Config.MaxBatch, 1))
 	for {
 		select {
 		case message, ok := <-c.Send:
@@ -73,13 +104,18 @@ func (c *Client) startWrite() {
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			batch = append(batch[:0], message)
+			size := len(message)
+			for n := len(c.Send); n > 0 && len(batch) < c.Config.MaxBatch; n-- {
+				queued, ok := <-c.Send
+				if !ok {
+					break
+				}
+				batch = append(batch, queued)
+				size += len(newline) + len(queued)
 			}
-			w.Write(message)
 
-			if err := w.Close(); err != nil {
+			if err := c.writeFrame(batch, size); err != nil {
 				return
 			}
 
@@ -91,3 +127,24 @@ func (c *Client) startWrite() {
 		}
 	}
 }
+
+// writeFrame writes a batch of messages as a single newline-delimited text
+// frame, compressing it when it is large enough to be worth it.
+func (c *Client) writeFrame(batch [][]byte, size int) error {
+	threshold := c.Config.CompressionThreshold
+	c.Conn.EnableWriteCompression(threshold > 0 && size >= threshold)
+
+	w, err := c.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	for i, message := range batch {
+		if i > 0 {
+			w.Write(newline)
+		}
+		w.Write(message)
+	}
+
+	return w.Close()
+}
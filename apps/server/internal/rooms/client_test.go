@@ -0,0 +1,187 @@
+package rooms
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+var benchMessage = []byte(`{"type":"MODIFY_DRAWING","payload":{"drawing":{"id":"3f1c2a9e-6a43-4a1e-9a57-0c7d2b1e8f44","type":"trendline","points":[{"time":1718035200,"price":67342.51},{"time":1718121600,"price":68110.02}],"style":{"color":"#2962FF","width":2,"dash":false}}}}`)
+
+// dialClient connects to a test server handing each upgraded connection to
+// serve, and returns the dialled end.
+func dialClient(t *testing.T, serve func(*websocket.Conn)) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		serve(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestQueuedMessagesShareOneFrame(t *testing.T) {
+	messages := [][]byte{
+		[]byte(`{"type":"TICK","payload":{"price":1}}`),
+		[]byte(`{"type":"CHAT","payload":{"text":"a b"}}`),
+		benchMessage,
+	}
+
+	conn := dialClient(t, func(conn *websocket.Conn) {
+		client := &Client{Conn: conn, Send: make(chan []byte, len(messages)), Config: DefaultWriteConfig}
+		for _, m := range messages {
+			client.Send <- m
+		}
+		go client.startWrite()
+	})
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := bytes.Split(frame, newline)
+	if len(got) != len(messages) {
+		t.Fatalf("frame split into %d messages, want %d: %q", len(got), len(messages), frame)
+	}
+	for i := range messages {
+		if !bytes.Equal(got[i], messages[i]) {
+			t.Errorf("message %d = %q, want %q", i, got[i], messages[i])
+		}
+	}
+}
+
+func TestReadMessagesCannotBreakFraming(t *testing.T) {
+	room := NewRoom("test", nil)
+	conn := dialClient(t, func(conn *websocket.Conn) {
+		client := &Client{Conn: conn, Room: room}
+		go client.startRead()
+	})
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{\"type\":\"CHAT\",\n\"payload\":\"x\"}\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-room.Broadcast:
+		if want := `{"type":"CHAT", "payload":"x"}`; string(msg.Data) != want {
+			t.Errorf("got %q, want %q", msg.Data, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not broadcast")
+	}
+}
+
+// benchmarkStartWrite pushes bursts of room traffic through startWrite and
+// reports how many frames and bytes actually crossed the wire.
+func benchmarkStartWrite(b *testing.B, config WriteConfig, burst int) {
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	clients := make(chan *Client, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		client := &Client{Conn: conn, Send: make(chan []byte, 256), Config: config}
+		go client.startWrite()
+		clients <- client
+	}))
+	defer server.Close()
+
+	var wire atomic.Int64
+	dialer := websocket.Dialer{
+		EnableCompression: true,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &countingConn{Conn: conn, read: &wire}, nil
+		},
+	}
+
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+	client := <-clients
+
+	total := b.N * burst
+	done := make(chan int)
+	go func() {
+		received, frames := 0, 0
+		for received < total {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			frames++
+			received += bytes.Count(data, newline) + 1
+		}
+		done <- frames
+	}()
+
+	wire.Store(0)
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < burst; j++ {
+			client.Send <- benchMessage
+		}
+	}
+	frames := <-done
+	elapsed := time.Since(start)
+	b.StopTimer()
+
+	close(client.Send)
+
+	b.ReportMetric(float64(frames)/elapsed.Seconds(), "frames/s")
+	b.ReportMetric(float64(frames)/float64(total), "frames/msg")
+	b.ReportMetric(float64(wire.Load())/float64(total), "wireB/msg")
+}
+
+func BenchmarkStartWrite(b *testing.B) {
+	single := WriteConfig{MaxBatch: 1}
+	batched := WriteConfig{MaxBatch: DefaultWriteConfig.MaxBatch}
+
+	b.Run("single", func(b *testing.B) { benchmarkStartWrite(b, single, 16) })
+	b.Run("batched", func(b *testing.B) { benchmarkStartWrite(b, batched, 16) })
+	b.Run("batched-deflate", func(b *testing.B) { benchmarkStartWrite(b, DefaultWriteConfig, 16) })
+	b.Run("single-deflate", func(b *testing.B) {
+		benchmarkStartWrite(b, WriteConfig{MaxBatch: 1, CompressionThreshold: 1, CompressionLevel: DefaultWriteConfig.CompressionLevel}, 16)
+	})
+}
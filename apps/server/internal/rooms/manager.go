@@ -3,14 +3,24 @@ package rooms
 import "sync"
 
 type RoomManager struct {
-	rooms map[string]*Room
-	mu    sync.RWMutex
+	Feed    TickerFeed
+	Candles CandleFeed
+	Symbols SymbolResolver
+	// Views, when set, is told of every chart a room selects that Listed
+	// knows
+	Views  ViewRecorder
+	Listed ProductLister
+	rooms  map[string]*Room
+	mu     sync.RWMutex
 }
 
-func NewManager() *RoomManager {
+func NewManager(feed TickerFeed, candles CandleFeed, symbols SymbolResolver) *RoomManager {
 	return &RoomManager{
-		rooms: make(map[string]*Room),
-		mu:    sync.RWMutex{},
+		Feed:    feed,
+		Candles: candles,
+		Symbols: symbols,
+		rooms:   make(map[string]*Room),
+		mu:      sync.RWMutex{},
 	}
 }
 
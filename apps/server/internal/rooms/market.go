@@ -0,0 +1,189 @@
+package rooms
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/0men1/cochart/internal/market"
+)
+
+// TickerFeed delivers live ticks for a market until the returned func is called.
+type TickerFeed interface {
+	Subscribe(exchange, symbol string, fn func(market.Tick)) (func(), error)
+}
+
+// CandleFeed delivers live candle events for a market until the returned
+// func is called.
+type CandleFeed interface {
+	Subscribe(exchange, symbol string, granularity int64, fn func(market.CandleEvent)) (func(), error)
+}
+
+// SymbolResolver translates a possibly canonical symbol into the market
+// that serves it.
+type SymbolResolver interface {
+	Resolve(exchange, symbol string) market.Market
+}
+
+// ViewRecorder counts which markets rooms look at.
+type ViewRecorder interface {
+	RecordView(m market.Market, viewer string)
+}
+
+// ProductLister looks up the markets the search index lists.
+type ProductLister interface {
+	Product(exchange, id string) (market.Product, bool)
+}
+
+type chart struct {
+	Exchange    string
+	Symbol      string
+	Granularity int64
+}
+
+type inboundAction struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type selectChartPayload struct {
+	Product struct {
+		Symbol   string `json:"symbol"`
+		Exchange string `json:"exchange"`
+	} `json:"product"`
+	Timeframe string `json:"timeframe"`
+}
+
+// parseAction decodes a client message. The web client sends actions as a
+// JSON encoded string, so both that and a plain object are accepted.
+func parseAction(data []byte) (inboundAction, bool) {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err == nil {
+		data = []byte(encoded)
+	}
+
+	var a inboundAction
+	if err := json.Unmarshal(data, &a); err != nil {
+		return inboundAction{}, false
+	}
+	return a, true
+}
+
+func (r *Room) trackSelection(data []byte) {
+	a, ok := parseAction(data)
+	if !ok || a.Type != "SELECT_CHART" {
+		return
+	}
+
+	var p selectChartPayload
+	if err := json.Unmarshal(a.Payload, &p); err != nil {
+		return
+	}
+
+	// Live candles are only built for epoch aligned timeframes
+	var granularity int64
+	if tf, ok := market.Timeframes[p.Timeframe]; ok && tf.Fixed() {
+		granularity = tf.Seconds
+	}
+
+	m := market.Market{Exchange: p.Product.Exchange, Symbol: p.Product.Symbol}
+	if r.Manager != nil && r.Manager.Symbols != nil && m.Symbol != "" {
+		m = r.Manager.Symbols.Resolve(m.Exchange, m.Symbol)
+	}
+	// Only listed markets are counted, so made up symbols cannot grow the
+	// view counts
+	if r.Manager != nil && r.Manager.Views != nil && r.Manager.Listed != nil {
+		if _, ok := r.Manager.Listed.Product(m.Exchange, m.Symbol); ok {
+			r.Manager.Views.RecordView(m, "room:"+r.ID)
+		}
+	}
+
+	r.selectChart(chart{
+		Exchange:    m.Exchange,
+		Symbol:      m.Symbol,
+		Granularity: granularity,
+	})
+}
+
+// selectChart moves the room's live market subscriptions to c. The new
+// subscriptions are taken before the old ones are released so a timeframe
+// change doesn't churn the shared upstream feed.
+func (r *Room) selectChart(c chart) {
+	if c == r.chart {
+		return
+	}
+
+	previous := r.unsubscribe
+	r.chart = c
+	r.unsubscribe = r.subscribe(c)
+
+	if previous != nil {
+		previous()
+	}
+}
+
+func (r *Room) subscribe(c chart) func() {
+	if c.Symbol == "" || r.Manager == nil {
+		return nil
+	}
+
+	var stops []func()
+	if r.Manager.Feed != nil {
+		stop, err := r.Manager.Feed.Subscribe(c.Exchange, c.Symbol, r.forwardTick)
+		if err != nil {
+			log.Printf("Room %s: can't stream %s on %s: %v\n", r.ID, c.Symbol, c.Exchange, err)
+		} else {
+			stops = append(stops, stop)
+		}
+	}
+
+	if r.Manager.Candles != nil && c.Granularity > 0 {
+		stop, err := r.Manager.Candles.Subscribe(c.Exchange, c.Symbol, c.Granularity, r.forwardCandle)
+		if err != nil {
+			log.Printf("Room %s: can't build candles for %s on %s: %v\n", r.ID, c.Symbol, c.Exchange, err)
+		} else {
+			stops = append(stops, stop)
+		}
+	}
+
+	if len(stops) == 0 {
+		return nil
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+func (r *Room) forwardTick(tick market.Tick) {
+	r.forward(Action{Type: "TICK", Payload: tick})
+}
+
+func (r *Room) forwardCandle(event market.CandleEvent) {
+	r.forward(Action{Type: event.Type, Payload: event})
+}
+
+func (r *Room) forward(a Action) {
+	action, err := json.Marshal(a)
+	if err != nil {
+		return
+	}
+
+	// Never hold up the shared upstream feed for a busy room. Ticks and
+	// candle updates are superseded by the next one and can be dropped,
+	// closed candles are queued instead
+	select {
+	case r.Ticks <- action:
+	default:
+		if a.Type == market.CandleClosed {
+			r.closedMu.Lock()
+			r.closed = append(r.closed, action)
+			r.closedMu.Unlock()
+
+			select {
+			case r.closedReady <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package rooms
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/0men1/cochart/internal/market"
+)
+
+type fakeFeed struct {
+	active map[chart]func(market.Tick)
+}
+
+func (f *fakeFeed) Subscribe(exchange, symbol string, fn func(market.Tick)) (func(), error) {
+	c := chart{Exchange: exchange, Symbol: symbol}
+	f.active[c] = fn
+	return func() { delete(f.active, c) }, nil
+}
+
+func selectChartMessage(t *testing.T, exchange, symbol string) []byte {
+	t.Helper()
+	action, _ := json.Marshal(map[string]any{
+		"type": "SELECT_CHART",
+		"payload": map[string]any{
+			"product":   map[string]string{"symbol": symbol, "name": symbol, "exchange": exchange},
+			"timeframe": "1m",
+		},
+	})
+	// The web client double encodes its actions
+	data, _ := json.Marshal(string(action))
+	return data
+}
+
+func TestRoomFollowsSelectedChart(t *testing.T) {
+	feed := &fakeFeed{active: make(map[chart]func(market.Tick))}
+	room := NewRoom("room", NewManager(feed, nil, nil))
+
+	room.trackSelection(selectChartMessage(t, "coinbase", "BTC-USD"))
+	room.trackSelection([]byte(`{"type":"ADD_DRAWING","payload":{}}`))
+	room.trackSelection(selectChartMessage(t, "coinbase", "ETH-USD"))
+
+	if len(feed.active) != 1 {
+		t.Fatalf("got %d active subscriptions, want 1", len(feed.active))
+	}
+	forward, ok := feed.active[chart{Exchange: "coinbase", Symbol: "ETH-USD"}]
+	if !ok {
+		t.Fatalf("room is not subscribed to the selected chart: %v", feed.active)
+	}
+
+	forward(market.Tick{Exchange: "coinbase", Symbol: "ETH-USD", Price: 3500})
+
+	var action struct {
+		Type    string      `json:"type"`
+		Payload market.Tick `json:"payload"`
+	}
+	if err := json.Unmarshal(<-room.Ticks, &action); err != nil {
+		t.Fatal(err)
+	}
+	if action.Type != "TICK" || action.Payload.Price != 3500 {
+		t.Fatalf("unexpected action %+v", action)
+	}
+
+	room.selectChart(chart{})
+	if len(feed.active) != 0 {
+		t.Fatal("room kept its subscription after cleanup")
+	}
+}
+
+// fakeListing lists the markets it holds.
+type fakeListing map[market.Market]bool
+
+func (l fakeListing) Product(exchange, id string) (market.Product, bool) {
+	if !l[market.Market{Exchange: exchange, Symbol: id}] {
+		return market.Product{}, false
+	}
+	return market.Product{ID: id, Exchange: exchange}, true
+}
+
+func TestRoomRecordsSelectedChart(t *testing.T) {
+	feed := &fakeFeed{active: make(map[chart]func(market.Tick))}
+	manager := NewManager(feed, nil, nil)
+	popularity := market.NewPopularity()
+	manager.Views = popularity
+	manager.Listed = fakeListing{{Exchange: "coinbase", Symbol: "BTC-USD"}: true}
+	room := NewRoom("room", manager)
+
+	room.trackSelection(selectChartMessage(t, "coinbase", "BTC-USD"))
+	room.trackSelection(selectChartMessage(t, "coinbase", "BTC-USD"))
+	room.trackSelection(selectChartMessage(t, "coinbase", "MADE-UP"))
+
+	scores := popularity.Scores()
+	score := scores[market.Market{Exchange: "coinbase", Symbol: "BTC-USD"}]
+	if score.Popular < 0.99 || score.Popular > 1.01 {
+		t.Errorf("BTC-USD popularity = %v, want one view", score.Popular)
+	}
+	if _, ok := scores[market.Market{Exchange: "coinbase", Symbol: "MADE-UP"}]; ok {
+		t.Error("an unlisted market was counted")
+	}
+}
+
+func TestRoomNeverDropsClosedCandles(t *testing.T) {
+	room := NewRoom("room", NewManager(nil, nil, nil))
+	for range cap(room.Ticks) {
+		room.forwardTick(market.Tick{Price: 1})
+	}
+
+	// The room is backed up: ticks and updates give way, closes wait
+	room.forwardTick(market.Tick{Price: 2})
+	room.forwardCandle(market.CandleEvent{Type: market.CandleUpdate})
+	room.forwardCandle(market.CandleEvent{Type: market.CandleClosed, Candle: market.Candlestick{Timestamp: 60}})
+
+	select {
+	case <-room.closedReady:
+	default:
+		t.Fatal("room wasn't told of the queued close")
+	}
+	if len(room.closed) != 1 {
+		t.Fatalf("got %d queued actions, want the close", len(room.closed))
+	}
+	var action struct {
+		Type    string             `json:"type"`
+		Payload market.CandleEvent `json:"payload"`
+	}
+	if err := json.Unmarshal(room.closed[0], &action); err != nil {
+		t.Fatal(err)
+	}
+	if action.Type != market.CandleClosed || action.Payload.Candle.Timestamp != 60 {
+		t.Errorf("queued %+v, want the closed candle", action)
+	}
+}
@@ -3,6 +3,7 @@ package rooms
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -12,17 +13,29 @@ type Room struct {
 	Clients    map[*Client]bool
 	Register   chan *Client
 	Unregister chan *Client
+	Ticks      chan []byte
 	Manager    *RoomManager
+
+	chart       chart
+	unsubscribe func()
+
+	// Closed candles wait here when Ticks is full, a missed close would
+	// leave a wrong bar on every chart in the room
+	closedMu    sync.Mutex
+	closed      [][]byte
+	closedReady chan struct{}
 }
 
 func NewRoom(id string, m *RoomManager) *Room {
 	return &Room{
-		ID:         id,
-		Broadcast:  make(chan *Message, 256),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Clients:    make(map[*Client]bool),
-		Manager:    m,
+		ID:          id,
+		Broadcast:   make(chan *Message, 256),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		Ticks:       make(chan []byte, 64),
+		closedReady: make(chan struct{}, 1),
+		Clients:     make(map[*Client]bool),
+		Manager:     m,
 	}
 }
 
@@ -72,13 +85,27 @@ func (r *Room) Start() {
 
 				if len(r.Clients) == 0 {
 					log.Printf("Room %s empty, cleaning up\n", r.ID)
+					r.selectChart(chart{})
 					r.Manager.RemoveRoom(r.ID)
 					return
 				}
 			}
 
 		case msg := <-r.Broadcast:
+			r.trackSelection(msg.Data)
 			r.broadcastToOthers(msg.Data, msg.Sender)
+
+		case tick := <-r.Ticks:
+			r.broadcastToAll(tick)
+
+		case <-r.closedReady:
+			r.closedMu.Lock()
+			closed := r.closed
+			r.closed = nil
+			r.closedMu.Unlock()
+			for _, action := range closed {
+				r.broadcastToAll(action)
+			}
 		}
 	}
 }
@@ -1,11 +1,13 @@
 import { Settings, Share2, Users, Wifi } from "lucide-react";
+import { useEffect, useState } from "react";
 import { Button } from "../ui/button";
 import { Tooltip, TooltipContent, TooltipTrigger } from "@/components/ui/tooltip";
-import { ConnectionStatus, IntervalKey } from "@/core/chart/market-data/types";
+import { ConnectionStatus, INTERVALS, IntervalKey } from "@/core/chart/market-data/types";
 import { useUIStore } from "@/stores/useUIStore";
 import { useChartStore } from "@/stores/useChartStore";
 import { Product } from "@/stores/types";
 import { useCollabStore } from "@/stores/useCollabStore";
+import { fetchProviders, ProviderInfo } from "@/core/chart/market-data/providers";
 
 
 function getStatusDiv(status: ConnectionStatus) {
@@ -34,7 +36,15 @@ export default function ChartHeader() {
 
 	const isInRoom = status === ConnectionStatus.CONNECTED && !!roomId;
 
-	const timeframes: string[] = ["1m", "5m", "15m", "1H", "6H", "1D"];
+	const [providers, setProviders] = useState<ProviderInfo[]>([]);
+
+	useEffect(() => {
+		fetchProviders().then(setProviders);
+	}, []);
+
+	const defaultTimeframes: string[] = INTERVALS;
+	const supported = providers.find((p) => p.id === product.exchange)?.timeframes;
+	const timeframes = supported ? defaultTimeframes.filter((t) => supported.includes(t)) : defaultTimeframes;
 
 	const handleChartUpdate = (product: Product, timeframe: IntervalKey) => {
 		selectChart(product, timeframe);
@@ -4,6 +4,7 @@ import { useState, useEffect, useRef } from "react";
 import TickerSearchItem from "./TickerSearchItem";
 import { useUIStore } from "@/stores/useUIStore";
 import { useChartStore } from "@/stores/useChartStore";
+import { fetchProviders, ProviderInfo } from "@/core/chart/market-data/providers";
 
 const SearchIcon = ({ className }: { className?: string }) => (
 	<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 24 24" fill="none" stroke="currentColor" strokeWidth="2" strokeLinecap="round" strokeLinejoin="round" className={className}>
@@ -25,6 +26,46 @@ interface SearchResult {
 	Type: string;
 }
 
+interface SearchPage {
+	results: SearchResult[];
+	total: number;
+	offset: number;
+	limit: number;
+	nextCursor?: string;
+}
+
+interface Suggestions {
+	trending: SearchResult[];
+	popular: SearchResult[];
+}
+
+// fetchSuggestions fills the empty search box with trending markets first,
+// then the most viewed ones.
+async function fetchSuggestions(signal: AbortSignal): Promise<SearchResult[]> {
+	const res = await fetch(`/api/search/suggest?l=8`, { signal });
+	if (!res.ok) return [];
+	const data: Suggestions = await res.json();
+	const seen = new Set<string>();
+	return [...(data.trending || []), ...(data.popular || [])].filter((item) => {
+		const key = `${item.Exchange}/${item.ID}`;
+		if (seen.has(key)) return false;
+		seen.add(key);
+		return true;
+	});
+}
+
+const QUOTE_FILTERS = ["USD", "USDT", "EUR"];
+const PAGE_SIZE = 20;
+
+function searchURL(query: string, exchange: string | null, quote: string | null, cursor?: string) {
+	const params = new URLSearchParams({ l: String(PAGE_SIZE) });
+	if (query.trim()) params.set("q", query);
+	if (exchange) params.set("exchange", exchange);
+	if (quote) params.set("quote", quote);
+	if (cursor) params.set("cursor", cursor);
+	return `/api/search?${params}`;
+}
+
 interface TickerSearchBoxProps {
 	onClose?: () => void;
 }
@@ -38,10 +79,18 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 	const [results, setResults] = useState<SearchResult[]>([]);
 	const [loading, setLoading] = useState(false);
 	const [cursor, setCursor] = useState(0);
+	const [exchange, setExchange] = useState<string | null>(null);
+	const [quote, setQuote] = useState<string | null>(null);
+	const [providers, setProviders] = useState<ProviderInfo[]>([]);
+	const [total, setTotal] = useState(0);
+	const [nextCursor, setNextCursor] = useState<string | undefined>();
+	const [loadingMore, setLoadingMore] = useState(false);
+	const [suggested, setSuggested] = useState(false);
 
 	const inputRef = useRef<HTMLInputElement>(null);
 	const resultsRef = useRef<SearchResult[]>([]);
 	const cursorRef = useRef(0);
+	const loadMoreRef = useRef<AbortController | null>(null);
 
 	useEffect(() => {
 		resultsRef.current = results;
@@ -57,11 +106,17 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 		}, data.timeframe);
 	};
 
+	useEffect(() => {
+		fetchProviders().then(setProviders);
+	}, []);
+
 	useEffect(() => {
 		if (!tickerSearchBox.isOpen) {
 			setQuery("");
 			setResults([]);
 			setCursor(0);
+			setExchange(null);
+			setQuote(null);
 		} else {
 			const term = tickerSearchBox.searchTerm;
 			setQuery(term);
@@ -119,16 +174,34 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 		const signal = controller.signal;
 
 		const timer = setTimeout(async () => {
-			if (!query.trim()) {
-				setResults([]);
+			if (!tickerSearchBox.isOpen) return;
+			setLoading(true);
+			setTotal(0);
+			setNextCursor(undefined);
+			if (!query.trim() && !exchange && !quote) {
+				try {
+					setResults(await fetchSuggestions(signal));
+					setSuggested(true);
+					setCursor(0);
+				} catch (error: any) {
+					if (error.name !== 'AbortError') {
+						console.error("Suggestions failed", error);
+					}
+				} finally {
+					if (!signal.aborted) {
+						setLoading(false);
+					}
+				}
 				return;
 			}
-			setLoading(true);
 			try {
-				const res = await fetch(`/api/search?q=${encodeURIComponent(query)}&l=20`, { signal });
+				const res = await fetch(searchURL(query, exchange, quote), { signal });
 				if (res.ok) {
-					const data = await res.json();
-					setResults(data || []);
+					const page: SearchPage = await res.json();
+					setResults(page.results || []);
+					setSuggested(false);
+					setTotal(page.total);
+					setNextCursor(page.nextCursor);
 					setCursor(0);
 				}
 			} catch (error: any) {
@@ -145,8 +218,45 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 		return () => {
 			clearTimeout(timer);
 			controller.abort();
+			// A page of the old search must not land in the new one
+			loadMoreRef.current?.abort();
 		};
-	}, [query]);
+	}, [query, exchange, quote, tickerSearchBox.isOpen]);
+
+	const loadMore = async () => {
+		if (!nextCursor || loading || loadingMore) return;
+		const controller = new AbortController();
+		loadMoreRef.current = controller;
+		setLoadingMore(true);
+		try {
+			const res = await fetch(searchURL(query, exchange, quote, nextCursor), { signal: controller.signal });
+			if (res.ok) {
+				const page: SearchPage = await res.json();
+				setResults((prev) => [...prev, ...(page.results || [])]);
+				setTotal(page.total);
+				setNextCursor(page.nextCursor);
+			}
+		} catch (error: any) {
+			if (error.name !== 'AbortError') {
+				console.error("Search failed", error);
+			}
+		} finally {
+			if (loadMoreRef.current === controller) {
+				loadMoreRef.current = null;
+			}
+			setLoadingMore(false);
+		}
+	};
+
+	const handleScroll = (e: React.UIEvent<HTMLDivElement>) => {
+		const el = e.currentTarget;
+		if (el.scrollHeight - el.scrollTop - el.clientHeight < 40) {
+			loadMore();
+		}
+	};
+
+	const filterClass = (active: boolean) =>
+		`shrink-0 text-xs rounded px-2 py-0.5 border transition-colors ${active ? "border-zinc-500 bg-zinc-800 text-zinc-100" : "border-zinc-800 text-zinc-400 hover:text-zinc-100"}`;
 
 	if (!tickerSearchBox.isOpen) return null;
 
@@ -167,7 +277,21 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 					/>
 				</div>
 
-				<div className="max-h-[50vh] md:max-h-[300px] overflow-y-auto overflow-x-hidden py-2 custom-scrollbar">
+				<div className="flex items-center gap-1 overflow-x-auto border-b border-zinc-800 px-3 py-2 [scrollbar-width:'none']">
+					{providers.map((p) => (
+						<button key={p.id} className={filterClass(exchange === p.id)} onClick={() => setExchange(exchange === p.id ? null : p.id)}>
+							{p.id}
+						</button>
+					))}
+					<div className="shrink-0 w-px h-4 bg-zinc-800 mx-1" />
+					{QUOTE_FILTERS.map((q) => (
+						<button key={q} className={filterClass(quote === q)} onClick={() => setQuote(quote === q ? null : q)}>
+							{q}
+						</button>
+					))}
+				</div>
+
+				<div className="max-h-[50vh] md:max-h-[300px] overflow-y-auto overflow-x-hidden py-2 custom-scrollbar" onScroll={handleScroll}>
 					{loading && (
 						<div className="py-6 text-center text-sm text-zinc-500 flex items-center justify-center gap-2">
 							<LoaderIcon className="h-4 w-4 animate-spin" />
@@ -175,12 +299,18 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 						</div>
 					)}
 
-					{!loading && results.length === 0 && query && (
+					{!loading && results.length === 0 && (query || exchange || quote) && (
 						<div className="py-6 text-center text-sm text-zinc-500">
 							No results found.
 						</div>
 					)}
 
+					{!loading && suggested && results.length > 0 && (
+						<div className="px-3 pb-1 text-[10px] uppercase tracking-wide text-zinc-500">
+							Trending & popular
+						</div>
+					)}
+
 					{!loading && results.map((ticker, index) => (
 						<div
 							key={`${ticker.ID}/${ticker.Exchange}`}
@@ -195,10 +325,21 @@ export default function TickerSearchBox({ onClose }: TickerSearchBoxProps) {
 							/>
 						</div>
 					))}
+
+					{loadingMore && (
+						<div className="py-2 flex justify-center">
+							<LoaderIcon className="h-4 w-4 animate-spin text-zinc-500" />
+						</div>
+					)}
 				</div>
 
 				<div className="hidden md:block border-t border-zinc-800 bg-zinc-900/50 p-2 px-4">
-					<div className="flex justify-end gap-2">
+					<div className="flex justify-end items-center gap-2">
+						{total > 0 && (
+							<span className="mr-auto text-[10px] text-zinc-500">
+								{results.length} of {total}
+							</span>
+						)}
 						<span className="text-[10px] text-zinc-500 bg-zinc-900 border border-zinc-800 rounded px-1.5 py-0.5 font-medium">
 							ESC
 						</span>
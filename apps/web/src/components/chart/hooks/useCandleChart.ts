@@ -11,15 +11,19 @@ import {
 	SeriesType,
 } from "cochart-charts";
 import { ThemeConfig } from "@/constants/theme";
-import { Candlestick, ConnectionState, ConnectionStatus, INTERVAL_SECONDS, TickData } from "@/core/chart/market-data/types";
-import { subscribeToTicks, subscribeToStatus } from "@/core/chart/market-data/tick-data";
+import { CandleEvent, Candlestick, ConnectionState, ConnectionStatus, INTERVAL_SECONDS, TickData, bucketStart } from "@/core/chart/market-data/types";
+import { subscribeToTicks, subscribeToStatus, subscribeToRoomTicks, subscribeToRoomCandles } from "@/core/chart/market-data/tick-data";
 import { fetchHistoricalCandles } from "@/core/chart/market-data/historical-data";
+import { fetchProductInfo } from "@/core/chart/market-data/products";
 import { useChartStore } from "@/stores/useChartStore";
+import { useCollabStore } from "@/stores/useCollabStore";
 
 export function useCandleChart(containerRef: React.RefObject<HTMLDivElement | null>) {
 	const { chartSettings } = useChartStore();
 	const { product, timeframe } = useChartStore((state) => state.data);
 	const { setDataConnectionState, setInstances } = useChartStore((state) => state);
+	const roomStatus = useCollabStore((state) => state.status);
+	const inRoom = roomStatus === ConnectionStatus.CONNECTED;
 
 	const chartRef = useRef<IChartApi | null>(null);
 	const seriesRef = useRef<ISeriesApi<SeriesType> | null>(null);
@@ -51,8 +55,8 @@ export function useCandleChart(containerRef: React.RefObject<HTMLDivElement | nu
 		if (!seriesRef.current) return;
 		if (activeSymbolRef.current !== product.symbol) return;
 
-		const rounded = Math.floor(tick.timestamp / interval) * interval;
-		const previousInterval = rounded - interval;
+		const rounded = bucketStart(tick.timestamp, timeframe);
+		const previousInterval = bucketStart(rounded - 1, timeframe);
 
 		if (currentCandles.current.size > 0 && !currentCandles.current.has(previousInterval) && !isFetching.current) {
 			const latestTime = currentCandle.current?.time as number || (rounded - interval);
@@ -81,6 +85,29 @@ export function useCandleChart(containerRef: React.RefObject<HTMLDivElement | nu
 
 		currentCandles.current.set(currentCandle.current.time as number, currentCandle.current);
 		seriesRef.current.update(currentCandle.current);
+	}, [interval, timeframe, seriesRef]);
+
+	// Candles built by the server replace the ones pieced together from
+	// ticks. A partial bar keeps the open and volume history gave it.
+	const applyCandle = useCallback((event: CandleEvent) => {
+		if (!seriesRef.current) return;
+		if (activeSymbolRef.current !== product.symbol || event.granularity !== interval) return;
+
+		const existing = currentCandles.current.get(event.candle.time as number);
+		const candle: Candlestick = event.partial && existing
+			? {
+				...existing,
+				high: Math.max(existing.high, event.candle.high),
+				low: Math.min(existing.low, event.candle.low),
+				close: event.candle.close,
+			}
+			: { ...event.candle };
+
+		if (currentCandle.current && (candle.time as number) < (currentCandle.current.time as number)) return;
+
+		currentCandles.current.set(candle.time as number, candle);
+		currentCandle.current = candle;
+		seriesRef.current.update(candle);
 	}, [interval, seriesRef]);
 
 	// HISTORICAL FETCH LOGIC
@@ -136,7 +163,7 @@ export function useCandleChart(containerRef: React.RefObject<HTMLDivElement | nu
 				secondsVisible: timeframe === '1m',
 				tickMarkFormatter: (time: number) => {
 					const date = new Date(time * 1000);
-					return (timeframe === '1D')
+					return (interval >= INTERVAL_SECONDS['1D'])
 						? date.toLocaleDateString([], { timeZone: chartSettings.timezone })
 						: date.toLocaleTimeString([], { timeZone: chartSettings.timezone, hour: '2-digit', minute: '2-digit', hour12: false });
 				}
@@ -208,8 +235,38 @@ export function useCandleChart(containerRef: React.RefObject<HTMLDivElement | nu
 
 	}, [product, timeframe, containerRef]);
 
+	// PRICE PRECISION
+	useEffect(() => {
+		let cancelled = false;
+		fetchProductInfo(product.exchange, product.symbol).then((info) => {
+			// Products with neither known keep the chart's default format
+			if (cancelled || !info || !seriesRef.current) return;
+			if (!info.PriceIncrement && !info.PricePrecision) return;
+			const precision = info.PricePrecision;
+			seriesRef.current.applyOptions({
+				priceFormat: {
+					type: 'price',
+					precision,
+					minMove: info.PriceIncrement || Math.pow(10, -precision),
+				},
+			});
+		});
+		return () => { cancelled = true; };
+	}, [product, timeframe]);
+
 	// WEBSOCKET SETUP
 	useEffect(() => {
+		// Room members share the room socket's feed of the room's chart
+		if (inRoom) {
+			const stopTicks = subscribeToRoomTicks(product.symbol, product.exchange, updateChart);
+			const stopCandles = subscribeToRoomCandles(product.symbol, product.exchange, applyCandle);
+			setDataConnectionState({ status: ConnectionStatus.CONNECTED, reconnectAttempts: 0 });
+			return () => {
+				stopTicks();
+				stopCandles();
+			};
+		}
+
 		const setupTickConnection = async () => {
 			try {
 				if (connectionState?.status !== ConnectionStatus.CONNECTED) {
@@ -230,7 +287,7 @@ export function useCandleChart(containerRef: React.RefObject<HTMLDivElement | nu
 			unsubscribeTickData.current?.();
 			setConnectionState(null);
 		};
-	}, [product, updateChart]);
+	}, [product, updateChart, applyCandle, inRoom]);
 
 	// RESET DATA ON SYMBOL CHANGE
 	useEffect(() => {
@@ -22,8 +22,11 @@ export class CollabSocket {
 		}
 
 		this.ws.onmessage = (event: MessageEvent) => {
-			const data = JSON.parse(event.data)
-			callbacks.onMessage(data)
+			// The server may batch several messages into one newline-delimited frame
+			for (const line of (event.data as string).split('\n')) {
+				if (!line) continue;
+				callbacks.onMessage(JSON.parse(line))
+			}
 		}
 
 		this.ws.onclose = () => {
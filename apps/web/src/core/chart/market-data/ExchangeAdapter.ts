@@ -72,6 +72,10 @@ export abstract class ExchangeAdapter {
 		};
 	}
 
+	get subscriptionCount(): number {
+		return this.subscriptions.size;
+	}
+
 	onStatusChange(callback: (status: ConnectionState) => void): () => void {
 		this.stateListeners.add(callback);
 		// Immediately notify current state
@@ -0,0 +1,34 @@
+export interface ProductInfo {
+	ID: string;
+	Name: string;
+	Exchange: string;
+	PriceIncrement: number;
+	SizeIncrement: number;
+	MinSize: number;
+	PricePrecision: number;
+	SizePrecision: number;
+	Status: string;
+	Spot: boolean;
+	Margin: boolean;
+}
+
+const productRequests = new Map<string, Promise<ProductInfo | null>>();
+
+export function fetchProductInfo(exchange: string, id: string): Promise<ProductInfo | null> {
+	const key = `${exchange}:${id}`;
+	let request = productRequests.get(key);
+	if (!request) {
+		request = fetch(`/api/products/${encodeURIComponent(exchange)}/${encodeURIComponent(id)}`)
+			.then(res => {
+				if (!res.ok) throw new Error(res.statusText);
+				return res.json();
+			})
+			.catch((err) => {
+				console.error("Failed to fetch product: ", err);
+				productRequests.delete(key);
+				return null;
+			});
+		productRequests.set(key, request);
+	}
+	return request;
+}
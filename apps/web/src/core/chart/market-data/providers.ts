@@ -0,0 +1,30 @@
+export interface ProviderInfo {
+	id: string;
+	capabilities: {
+		granularities: number[];
+		maxCandlesPerRequest: number;
+		historyStart?: number;
+		// Only this many recent candles of each granularity exist
+		maxHistoryCandles?: number;
+		assetTypes: string[];
+	};
+	timeframes: string[];
+}
+
+let providersRequest: Promise<ProviderInfo[]> | null = null;
+
+export function fetchProviders(): Promise<ProviderInfo[]> {
+	if (!providersRequest) {
+		providersRequest = fetch('/api/providers')
+			.then(res => {
+				if (!res.ok) throw new Error(res.statusText);
+				return res.json();
+			})
+			.catch((err) => {
+				console.error("Failed to fetch providers: ", err);
+				providersRequest = null;
+				return [];
+			});
+	}
+	return providersRequest;
+}
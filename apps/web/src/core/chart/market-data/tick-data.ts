@@ -1,9 +1,14 @@
 import { ExchangeAdapter } from "@/core/chart/market-data/ExchangeAdapter";
-import { ConnectionState, TickData } from "@/core/chart/market-data/types";
+import { CandleEvent, ConnectionState, TickData } from "@/core/chart/market-data/types";
 
 // CACHE
 const adaptersCache: Map<string, ExchangeAdapter> = new Map();
 const statusListeners: Map<string, Set<(state: ConnectionState) => void>> = new Map();
+const idleTimers: Map<string, ReturnType<typeof setTimeout>> = new Map();
+
+// How long an exchange socket nobody listens to stays open, so switching
+// symbols doesn't reconnect
+const IDLE_DISCONNECT_MS = 10_000;
 
 // REGISTRY
 const exchangeRegistry: Partial<Record<string, () => Promise<ExchangeAdapter>>> = {
@@ -53,7 +58,24 @@ export async function subscribeToTicks(
 		throw new Error("failed to subscribe to tick data")
 	}
 
-	return exchangeAdapter.subscribe(symbol, onTick);
+	clearTimeout(idleTimers.get(exchange));
+	idleTimers.delete(exchange);
+
+	const unsubscribe = exchangeAdapter.subscribe(symbol, onTick);
+	return () => {
+		unsubscribe();
+		if (exchangeAdapter.subscriptionCount > 0) return;
+
+		// Close the socket once nothing needs it, e.g. after joining a room
+		clearTimeout(idleTimers.get(exchange));
+		idleTimers.set(exchange, setTimeout(() => {
+			idleTimers.delete(exchange);
+			if (exchangeAdapter.subscriptionCount > 0 || adaptersCache.get(exchange) !== exchangeAdapter) return;
+			exchangeAdapter.disconnect();
+			adaptersCache.delete(exchange);
+			statusListeners.delete(exchange);
+		}, IDLE_DISCONNECT_MS));
+	};
 }
 
 export async function subscribeToStatus(
@@ -69,3 +91,43 @@ export async function subscribeToStatus(
 	}
 	return null;
 }
+
+// ROOM FEED
+// Inside a room the server streams the room's chart over the room socket,
+// so members take ticks and candles from there instead of each opening a
+// socket to the exchange.
+const roomTickListeners: Map<string, Set<(t: TickData) => void>> = new Map();
+const roomCandleListeners: Map<string, Set<(e: CandleEvent) => void>> = new Map();
+
+function roomKey(symbol: string, exchange: string): string {
+	return `${exchange}:${symbol.toUpperCase()}`;
+}
+
+function addListener<T>(listeners: Map<string, Set<T>>, key: string, fn: T): () => void {
+	let set = listeners.get(key);
+	if (!set) {
+		set = new Set();
+		listeners.set(key, set);
+	}
+	set.add(fn);
+	return () => {
+		set.delete(fn);
+		if (set.size === 0) listeners.delete(key);
+	};
+}
+
+export function publishRoomTick(tick: TickData & { exchange: string }) {
+	roomTickListeners.get(roomKey(tick.symbol, tick.exchange))?.forEach(fn => fn(tick));
+}
+
+export function publishRoomCandle(event: CandleEvent) {
+	roomCandleListeners.get(roomKey(event.symbol, event.exchange))?.forEach(fn => fn(event));
+}
+
+export function subscribeToRoomTicks(symbol: string, exchange: string, onTick: (t: TickData) => void): () => void {
+	return addListener(roomTickListeners, roomKey(symbol, exchange), onTick);
+}
+
+export function subscribeToRoomCandles(symbol: string, exchange: string, onCandle: (e: CandleEvent) => void): () => void {
+	return addListener(roomCandleListeners, roomKey(symbol, exchange), onCandle);
+}
@@ -18,6 +18,17 @@ export interface TickData {
 	ask?: number;
 }
 
+export interface CandleEvent {
+	type: 'CANDLE_UPDATE' | 'CANDLE_CLOSED';
+	exchange: string;
+	symbol: string;
+	granularity: number;
+	candle: Candlestick;
+	// The bar was already open when the server started building it, so only
+	// its high, low and close are complete
+	partial?: boolean;
+}
+
 export interface ExchangeConfig {
 	name: string;
 	wsUrl: string;
@@ -49,13 +60,39 @@ export interface ConnectionState {
 	error?: string;
 }
 
-export type IntervalKey = '1m' | '5m' | '15m' | '1H' | '6H' | '1D';
+export type IntervalKey = '1m' | '3m' | '5m' | '15m' | '30m' | '1H' | '2H' | '4H' | '6H' | '12H' | '1D' | '1W' | '1M';
+
+export const INTERVALS: IntervalKey[] = ['1m', '3m', '5m', '15m', '30m', '1H', '2H', '4H', '6H', '12H', '1D', '1W', '1M'];
 
+// Bucket lengths. A month varies, so 1M gives its longest and is only
+// used for sizing ranges; bucketStart does the calendar maths.
 export const INTERVAL_SECONDS: Record<string, number> = {
 	"1m": 60,
+	'3m': 3 * 60,
 	'5m': 5 * 60,
 	'15m': 15 * 60,
+	'30m': 30 * 60,
 	'1H': 60 * 60,
+	'2H': 2 * 60 * 60,
+	'4H': 4 * 60 * 60,
 	'6H': 6 * 60 * 60,
+	'12H': 12 * 60 * 60,
 	'1D': 24 * 60 * 60,
+	'1W': 7 * 24 * 60 * 60,
+	'1M': 31 * 24 * 60 * 60,
+}
+
+// The epoch fell on a Thursday, weeks start on the following Monday
+const MONDAY_OFFSET = 4 * 24 * 60 * 60;
+
+// bucketStart aligns a unix timestamp to its candle the way the server
+// does: weeks start Monday 00:00 UTC and months on the 1st.
+export function bucketStart(timestamp: number, timeframe: string): number {
+	if (timeframe === '1M') {
+		const date = new Date(timestamp * 1000);
+		return Date.UTC(date.getUTCFullYear(), date.getUTCMonth(), 1) / 1000;
+	}
+	const interval = INTERVAL_SECONDS[timeframe];
+	const offset = timeframe === '1W' ? MONDAY_OFFSET : 0;
+	return Math.floor((timestamp - offset) / interval) * interval + offset;
 }
@@ -36,4 +36,8 @@ export enum CollabAction {
 	ADD_DRAWING = 'ADD_DRAWING',
 	DELETE_DRAWING = 'DELETE_DRAWING',
 	MODIFY_DRAWING = 'MODIFY_DRAWING',
+	// Sent by the server for the room's chart
+	TICK = 'TICK',
+	CANDLE_UPDATE = 'CANDLE_UPDATE',
+	CANDLE_CLOSED = 'CANDLE_CLOSED',
 }
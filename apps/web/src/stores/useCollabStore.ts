@@ -3,6 +3,7 @@ import { ConnectionStatus } from "@/core/chart/market-data/types";
 import { create } from "zustand";
 import { useChartStore } from "./useChartStore";
 import { CollabAction } from "./types";
+import { publishRoomCandle, publishRoomTick } from "@/core/chart/market-data/tick-data";
 
 interface CollabState {
 	isOpen: boolean;
@@ -64,7 +65,13 @@ export const useCollabStore = create<CollabState>((set, get) => ({
 					case CollabAction.MODIFY_DRAWING:
 						syncModifyDrawing(incomingAction.payload.drawing);
 						break;
-
+					case CollabAction.TICK:
+						publishRoomTick(incomingAction.payload);
+						break;
+					case CollabAction.CANDLE_UPDATE:
+					case CollabAction.CANDLE_CLOSED:
+						publishRoomCandle(incomingAction.payload);
+						break;
 				}
 			},
 			onClose: () => {